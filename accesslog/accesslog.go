@@ -0,0 +1,190 @@
+// Package accesslog writes one line per served request, in the Apache Common or Combined format,
+// as JSON or from a custom template:
+//
+//	server.AccessLog = accesslog.New(accesslog.Config{Format: accesslog.COMBINED, Exclude: []string{"/healthz"}})
+//
+// Lines are written by the server once the response has been sent, with its real status and size.
+// Every response is logged, including those of requests matching no route or rejected before routing,
+// e.g., 404, 408, 413, 431 and 503.
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+// Format is the format of the lines of an access log.
+type Format int
+
+// Enumeration of Format.
+const (
+	COMMON   Format = iota // Apache Common Log Format: host ident user [time] "request" status bytes.
+	COMBINED               // Apache Combined Log Format: the Common format followed by the referer and the user agent.
+	JSON                   // One JSON object per line, with every field of Entry.
+	TEMPLATE               // Config.Template, executed with an Entry.
+)
+
+// clfTimeFormat is the time format of the Common and Combined formats.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Config configures an access log.
+type Config struct {
+	Format     Format    // Format of the lines, COMMON when zero.
+	Template   string    // text/template of the lines in the TEMPLATE format, e.g., `{{.Method}} {{.Route}} {{.Status}} {{.Latency}}`.
+	Output     io.Writer // Destination of the lines, os.Stdout when nil.
+	SampleRate float64   // Fraction of the requests logged, between 0 and 1; every request is logged when zero.
+	Exclude    []string  // Paths of the requests not logged, e.g., "/healthz"; a trailing "*" matches a prefix, e.g., "/static/*".
+}
+
+// Entry describes a served request.
+type Entry struct {
+	Time       time.Time     `json:"time"`                 // Time at which the request was received.
+	RemoteAddr string        `json:"remote_addr"`          // Network address of the client.
+	Method     string        `json:"method"`               // HTTP method of the request.
+	URI        string        `json:"uri"`                  // Target of the request, with its query.
+	Protocol   string        `json:"protocol"`             // Protocol of the request, e.g., "HTTP/1.1".
+	Route      string        `json:"route"`                // Template of the matched route, e.g., "/users/:id", empty when none matched.
+	Status     int           `json:"status"`               // Status code of the response.
+	Bytes      int64         `json:"bytes"`                // Number of body bytes of the response.
+	Latency    time.Duration `json:"-"`                    // Time taken to serve the request, written as "latency_ms" in JSON.
+	Referer    string        `json:"referer,omitempty"`    // Referer header of the request.
+	UserAgent  string        `json:"user_agent,omitempty"` // User-Agent header of the request.
+	RequestID  string        `json:"request_id"`           // ID of the request.
+}
+
+// RemoteHost returns the host of RemoteAddr, without its port.
+func (entry Entry) RemoteHost() string {
+	if host, _, err := net.SplitHostPort(entry.RemoteAddr); err == nil {
+		return host
+	}
+	return entry.RemoteAddr
+}
+
+// Logger writes the access log of a server. It is set as Server.AccessLog.
+type Logger struct {
+	config   Config
+	output   io.Writer
+	template *template.Template
+	mutex    sync.Mutex // Serializes the writes to output.
+}
+
+// New returns a logger writing the access log configured by config.
+// It panics if the template of the TEMPLATE format is invalid.
+func New(config Config) *Logger {
+	log := &Logger{config: config, output: config.Output}
+	if log.output == nil {
+		log.output = os.Stdout
+	}
+	if config.Format == TEMPLATE {
+		log.template = template.Must(template.New("accesslog").Parse(config.Template))
+	}
+	return log
+}
+
+// Log writes the line of a served request, unless it is excluded or not sampled.
+// route is the template of the matched route, e.g., "/users/:id", "" when none matched.
+func (log *Logger) Log(request core.Request, route string, completion core.Completion) {
+	if !log.sampled(request) {
+		return
+	}
+	entry := Entry{
+		Time:       request.StartTime,
+		RemoteAddr: request.RemoteAddr,
+		Method:     request.Method,
+		URI:        requestURI(request),
+		Protocol:   request.Protocol,
+		Route:      route,
+		Status:     completion.StatusCode,
+		Bytes:      completion.Bytes,
+		Latency:    completion.Duration,
+		Referer:    request.Headers.Get("Referer"),
+		UserAgent:  request.Headers.Get("User-Agent"),
+		RequestID:  request.ID,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	log.write(entry)
+}
+
+// sampled reports whether the request is logged, according to the exclusions and the sample rate.
+func (log *Logger) sampled(request core.Request) bool {
+	path := "/" + request.Endpoint
+	for _, excluded := range log.config.Exclude {
+		if prefix, isPrefix := strings.CutSuffix(excluded, "*"); (isPrefix && strings.HasPrefix(path, prefix)) || path == excluded {
+			return false
+		}
+	}
+	return log.config.SampleRate <= 0 || log.config.SampleRate >= 1 || rand.Float64() < log.config.SampleRate
+}
+
+// write formats the entry and writes it as a line.
+func (log *Logger) write(entry Entry) {
+	var line bytes.Buffer
+	switch log.config.Format {
+	case COMBINED:
+		writeCommon(&line, entry)
+		fmt.Fprintf(&line, " %s %s", quote(entry.Referer), quote(entry.UserAgent))
+	case JSON:
+		encoder := json.NewEncoder(&line)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(struct {
+			Entry
+			LatencyMs float64 `json:"latency_ms"`
+		}{entry, float64(entry.Latency) / float64(time.Millisecond)})
+		line.Truncate(line.Len() - 1) // Encode ends the object with a newline.
+	case TEMPLATE:
+		if err := log.template.Execute(&line, entry); err != nil {
+			fmt.Fprintf(&line, "accesslog: %v", err)
+		}
+	default:
+		writeCommon(&line, entry)
+	}
+	line.WriteByte('\n')
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.output.Write(line.Bytes())
+}
+
+// writeCommon writes the entry in the Common Log Format.
+func writeCommon(line *bytes.Buffer, entry Entry) {
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	fmt.Fprintf(line, "%s - - [%s] %s %d %s", entry.RemoteHost(), entry.Time.Format(clfTimeFormat),
+		quote(entry.Method+" "+entry.URI+" "+entry.Protocol), entry.Status, size)
+}
+
+// quote returns the value between double quotes, with quotes and backslashes escaped, or "-" when it is empty.
+func quote(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// requestURI returns the target of the request, rebuilt from its endpoint and query when it was not recorded.
+func requestURI(request core.Request) string {
+	if request.RequestURI != "" {
+		return request.RequestURI
+	}
+	uri := "/" + request.Endpoint
+	if len(request.Query) > 0 {
+		uri += "?" + strings.Join(request.Query, "&")
+	}
+	return uri
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// Handler is the signature shared by route handler functions.
+type Handler func(request Request) Response
+
+// Middleware wraps a Handler to run logic before and after it, e.g. to attach values to the request context.
+type Middleware func(next Handler) Handler
+
+// Context returns the request's context.
+// The context is cancelled when the client disconnects, when the server shuts down or when the route timeout expires.
+// It is never nil; requests built without a context get context.Background().
+func (request Request) Context() context.Context {
+	if request.ctx != nil {
+		return request.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a copy of the request whose context is replaced by ctx.
+func (request Request) WithContext(ctx context.Context) Request {
+	if ctx == nil {
+		panic("core: nil context")
+	}
+	request.ctx = ctx
+	return request
+}
+
+// Key is a typed key for request-scoped values, used to pass data such as the current user
+// or a trace ID from middlewares to handlers without type assertions.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates a new Key. Each call returns a distinct key, even for identical names.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key, mainly for debugging purposes.
+func (key *Key[T]) String() string {
+	return key.name
+}
+
+// Set returns a copy of the request carrying value under the key.
+func (key *Key[T]) Set(request Request, value T) Request {
+	return request.WithContext(context.WithValue(request.Context(), key, value))
+}
+
+// Get returns the value stored under the key and whether it was present.
+func (key *Key[T]) Get(request Request) (T, bool) {
+	value, ok := request.Context().Value(key).(T)
+	return value, ok
+}
+
+// MustGet returns the value stored under the key and panics if it is missing.
+func (key *Key[T]) MustGet(request Request) T {
+	value, ok := key.Get(request)
+	if !ok {
+		panic("core: no value for key " + key.name)
+	}
+	return value
+}
+
+// Timeout returns a Middleware that cancels the request context after the given duration.
+// If the handler has not returned by then, a 503 Service Unavailable response is sent instead;
+// the handler keeps running in the background and should stop once its context is done.
+// The timeout only bounds the handler: the body of a streamed or hijacked response, produced once the handler
+// has returned, keeps the request context until it is done. Expired contexts report context.DeadlineExceeded
+// as their context.Cause.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(request Request) Response {
+			ctx, cancel := context.WithCancelCause(request.Context())
+			timer := time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+
+			done := make(chan Response, 1)
+			go func() {
+				done <- next(request.WithContext(ctx))
+			}()
+
+			select {
+			case response := <-done:
+				timer.Stop()
+				return cancelAfterBody(response, func() { cancel(nil) })
+			case <-ctx.Done():
+				cancel(nil)
+				return Response{Content: "Service Unavailable", ContentType: PLAINTEXT, StatusCode: 503, StatusText: "Service Unavailable"}
+			}
+		}
+	}
+}
+
+// cancelAfterBody calls cancel once the body of the response is written: right away for buffered responses,
+// at the end of the Stream or Hijack function, or once an io.Reader Content is copied, for the others.
+func cancelAfterBody(response Response, cancel func()) Response {
+	switch {
+	case response.Hijack != nil:
+		hijack := response.Hijack
+		response.Hijack = func(conn net.Conn, reader *bufio.Reader) {
+			defer cancel()
+			hijack(conn, reader)
+		}
+	case response.Stream != nil:
+		stream := response.Stream
+		response.Stream = func(writer StreamWriter) error {
+			defer cancel()
+			return stream(writer)
+		}
+	default:
+		if reader, ok := response.Content.(io.Reader); ok {
+			response.Content = &cancelReader{Reader: reader, cancel: cancel}
+		} else {
+			cancel()
+		}
+	}
+	return response
+}
+
+// cancelReader is an io.Reader Content calling cancel when the server closes it, after copying it.
+type cancelReader struct {
+	io.Reader
+	cancel func()
+}
+
+// Close closes the underlying reader if it is an io.Closer, then calls cancel.
+func (reader *cancelReader) Close() error {
+	defer reader.cancel()
+	if closer, ok := reader.Reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// LoggerKey holds the request-scoped slog.Logger. The server sets it with the request ID, method and route
+// as attributes; a middleware may replace it to add attributes, e.g., the current user.
+var LoggerKey = NewKey[*slog.Logger]("logger")
+
+// Logger returns the request-scoped slog.Logger, or slog.Default() if there is none.
+func (request Request) Logger() *slog.Logger {
+	if logger, ok := LoggerKey.Get(request); ok && logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Completion describes a response once the server has written it.
+type Completion struct {
+	StatusCode int           // Status code sent to the client, 0 when the connection was hijacked without one.
+	Bytes      int64         // Number of body bytes written.
+	Duration   time.Duration // Time elapsed since the server started reading the request.
+}
+
+// CompletionHooks holds the functions to call once the response to a request is written.
+type CompletionHooks struct {
+	mutex sync.Mutex
+	hooks []func(Completion)
+}
+
+// Add registers a function.
+func (hooks *CompletionHooks) Add(hook func(Completion)) {
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	hooks.hooks = append(hooks.hooks, hook)
+}
+
+// Run calls the registered functions, in order.
+func (hooks *CompletionHooks) Run(completion Completion) {
+	hooks.mutex.Lock()
+	registered := hooks.hooks
+	hooks.mutex.Unlock()
+	for _, hook := range registered {
+		hook(completion)
+	}
+}
+
+// CompletionHooksKey holds the CompletionHooks of a request, set by the server.
+var CompletionHooksKey = NewKey[*CompletionHooks]("completion-hooks")
+
+// OnComplete registers a function called once the response to the request has been written, e.g., to log its
+// status and size. It reports false, without registering the function, for requests not served by a server.
+func (request Request) OnComplete(hook func(Completion)) bool {
+	hooks, ok := CompletionHooksKey.Get(request)
+	if !ok || hooks == nil {
+		return false
+	}
+	hooks.Add(hook)
+	return true
+}
@@ -0,0 +1,328 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameSite defines the SameSite attribute of a cookie.
+type SameSite int
+
+// Enumeration of SameSite. SameSiteDefaultMode omits the attribute and lets the browser apply its default.
+const (
+	SameSiteDefaultMode SameSite = iota // No SameSite attribute.
+	SameSiteLaxMode                     // SameSite=Lax
+	SameSiteStrictMode                  // SameSite=Strict
+	SameSiteNoneMode                    // SameSite=None, which requires Secure.
+)
+
+// Cookie represents an HTTP cookie, as received in the Cookie header or sent in a Set-Cookie header.
+// Only Name and Value are filled for request cookies.
+type Cookie struct {
+	Name        string    // Name of the cookie.
+	Value       string    // Value of the cookie.
+	Path        string    // Path attribute, e.g., "/".
+	Domain      string    // Domain attribute.
+	Expires     time.Time // Expires attribute, omitted when zero.
+	MaxAge      int       // Max-Age attribute: 0 omits it, a negative value deletes the cookie immediately.
+	Secure      bool      // Secure attribute, the cookie is only sent over HTTPS.
+	HttpOnly    bool      // HttpOnly attribute, the cookie is not readable from JavaScript.
+	SameSite    SameSite  // SameSite attribute.
+	Partitioned bool      // Partitioned attribute (CHIPS), which requires Secure.
+}
+
+// Errors returned by the cookie helpers.
+var (
+	ErrNoCookie         = errors.New("core: named cookie not present")
+	ErrNoCookieSigner   = errors.New("core: no cookie signer configured")
+	ErrInvalidSignature = errors.New("core: invalid cookie signature")
+	ErrInvalidCookie    = errors.New("core: invalid cookie value")
+	ErrCookieExpired    = errors.New("core: cookie expired")
+)
+
+// String returns the serialization of the cookie for a Set-Cookie header.
+// It returns an empty string if the cookie name is invalid.
+func (cookie *Cookie) String() string {
+	if !isCookieNameValid(cookie.Name) {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString(cookie.Name + "=" + sanitizeCookieValue(cookie.Value))
+	if cookie.Path != "" {
+		builder.WriteString("; Path=" + sanitizeCookieAttribute(cookie.Path))
+	}
+	if cookie.Domain != "" {
+		builder.WriteString("; Domain=" + sanitizeCookieAttribute(strings.TrimPrefix(cookie.Domain, ".")))
+	}
+	if !cookie.Expires.IsZero() {
+		builder.WriteString("; Expires=" + cookie.Expires.UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"))
+	}
+	if cookie.MaxAge > 0 {
+		builder.WriteString("; Max-Age=" + strconv.Itoa(cookie.MaxAge))
+	} else if cookie.MaxAge < 0 {
+		builder.WriteString("; Max-Age=0")
+	}
+	if cookie.HttpOnly {
+		builder.WriteString("; HttpOnly")
+	}
+	if cookie.Secure {
+		builder.WriteString("; Secure")
+	}
+	switch cookie.SameSite {
+	case SameSiteLaxMode:
+		builder.WriteString("; SameSite=Lax")
+	case SameSiteStrictMode:
+		builder.WriteString("; SameSite=Strict")
+	case SameSiteNoneMode:
+		builder.WriteString("; SameSite=None")
+	}
+	if cookie.Partitioned {
+		builder.WriteString("; Partitioned")
+	}
+	return builder.String()
+}
+
+// Cookies parses and returns the cookies sent with the request. Malformed cookies are skipped.
+func (request Request) Cookies() []*Cookie {
+	var cookies []*Cookie
+	for _, line := range request.Headers.Values("Cookie") {
+		for _, part := range strings.Split(line, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+			if !found || !isCookieNameValid(name) {
+				continue
+			}
+			if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = value[1 : len(value)-1]
+			}
+			cookies = append(cookies, &Cookie{Name: name, Value: value})
+		}
+	}
+	return cookies
+}
+
+// Cookie returns the named cookie sent with the request, or ErrNoCookie if it is missing.
+// If several cookies share the name, the first one is returned.
+func (request Request) Cookie(name string) (*Cookie, error) {
+	for _, cookie := range request.Cookies() {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
+
+// SetCookie adds a Set-Cookie header to the response. Cookies with an invalid name are ignored.
+func (response *Response) SetCookie(cookie *Cookie) {
+	if serialized := cookie.String(); serialized != "" {
+		response.Header().Add("Set-Cookie", serialized)
+	}
+}
+
+// DeleteCookie instructs the client to remove a cookie. Path, Domain, Secure and Partitioned
+// must match the ones used when the cookie was set, so the given cookie is reused with an empty value.
+func (response *Response) DeleteCookie(cookie *Cookie) {
+	expired := *cookie
+	expired.Value = ""
+	expired.Expires = time.Unix(0, 0)
+	expired.MaxAge = -1
+	response.SetCookie(&expired)
+}
+
+// CookieSignerKey holds the CookieSigner of a request. The server sets it from its CookieSecret;
+// a middleware may replace it to use a different secret for some routes.
+var CookieSignerKey = NewKey[*CookieSigner]("cookie-signer")
+
+// CookieSigner returns the CookieSigner configured for the request, or nil if there is none.
+func (request Request) CookieSigner() *CookieSigner {
+	signer, _ := CookieSignerKey.Get(request)
+	return signer
+}
+
+// SignedCookie returns the verified value of a cookie set with CookieSigner.Sign.
+func (request Request) SignedCookie(name string) (string, error) {
+	signer := request.CookieSigner()
+	if signer == nil {
+		return "", ErrNoCookieSigner
+	}
+	cookie, err := request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return signer.Verify(cookie)
+}
+
+// EncryptedCookie returns the decrypted value of a cookie set with CookieSigner.Encrypt.
+func (request Request) EncryptedCookie(name string) (string, error) {
+	signer := request.CookieSigner()
+	if signer == nil {
+		return "", ErrNoCookieSigner
+	}
+	cookie, err := request.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return signer.Decrypt(cookie)
+}
+
+// CookieSigner signs and encrypts cookie values with keys derived from a secret.
+// Signed values are readable but tamper-proof (HMAC-SHA256), encrypted values are also confidential (AES-256-GCM).
+// The cookie name is bound to the value, so a value cannot be moved from one cookie to another, and so is the
+// expiry of the cookie, so a value replayed after its MaxAge or Expires is rejected with ErrCookieExpired.
+type CookieSigner struct {
+	signingKey []byte
+	aead       cipher.AEAD
+}
+
+// NewCookieSigner creates a CookieSigner from a secret, which should be at least 32 random bytes.
+func NewCookieSigner(secret []byte) *CookieSigner {
+	signingKey := sha256.Sum256(append([]byte("sprint-cookie-signing:"), secret...))
+	encryptionKey := sha256.Sum256(append([]byte("sprint-cookie-encryption:"), secret...))
+	block, err := aes.NewCipher(encryptionKey[:])
+	if err != nil {
+		panic(err) // Unreachable: the key is always 32 bytes long.
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &CookieSigner{signingKey: signingKey[:], aead: aead}
+}
+
+// Sign returns a copy of the cookie whose value is followed by its expiry, in Unix seconds or 0 for none,
+// and by their signature.
+func (signer *CookieSigner) Sign(cookie Cookie) *Cookie {
+	payload := cookie.Value + "." + strconv.FormatInt(cookieExpiry(cookie), 10)
+	cookie.Value = payload + "." + base64.RawURLEncoding.EncodeToString(signer.mac(cookie.Name, payload))
+	return &cookie
+}
+
+// Verify checks the signature and the expiry of a cookie created with Sign and returns its original value.
+func (signer *CookieSigner) Verify(cookie *Cookie) (string, error) {
+	index := strings.LastIndexByte(cookie.Value, '.')
+	if index < 0 {
+		return "", ErrInvalidSignature
+	}
+	payload := cookie.Value[:index]
+	signature, err := base64.RawURLEncoding.DecodeString(cookie.Value[index+1:])
+	if err != nil || !hmac.Equal(signature, signer.mac(cookie.Name, payload)) {
+		return "", ErrInvalidSignature
+	}
+	index = strings.LastIndexByte(payload, '.')
+	if index < 0 {
+		return "", ErrInvalidSignature
+	}
+	expiry, err := strconv.ParseInt(payload[index+1:], 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if isExpired(expiry) {
+		return "", ErrCookieExpired
+	}
+	return payload[:index], nil
+}
+
+// Encrypt returns a copy of the cookie whose value is encrypted and authenticated.
+func (signer *CookieSigner) Encrypt(cookie Cookie) (*Cookie, error) {
+	nonce := make([]byte, signer.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The expiry precedes the value in the plaintext, as 8 big-endian bytes.
+	plaintext := binary.BigEndian.AppendUint64(nil, uint64(cookieExpiry(cookie)))
+	sealed := signer.aead.Seal(nonce, nonce, append(plaintext, cookie.Value...), []byte(cookie.Name))
+	cookie.Value = base64.RawURLEncoding.EncodeToString(sealed)
+	return &cookie, nil
+}
+
+// Decrypt checks the expiry of a cookie created with Encrypt and returns its original value.
+func (signer *CookieSigner) Decrypt(cookie *Cookie) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	nonceSize := signer.aead.NonceSize()
+	if err != nil || len(sealed) < nonceSize {
+		return "", ErrInvalidCookie
+	}
+	plaintext, err := signer.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(cookie.Name))
+	if err != nil || len(plaintext) < 8 {
+		return "", ErrInvalidCookie
+	}
+	if isExpired(int64(binary.BigEndian.Uint64(plaintext))) {
+		return "", ErrCookieExpired
+	}
+	return string(plaintext[8:]), nil
+}
+
+// cookieExpiry returns the expiry of a cookie in Unix seconds, from its MaxAge or else its Expires,
+// or 0 when it has none.
+func cookieExpiry(cookie Cookie) int64 {
+	switch {
+	case cookie.MaxAge > 0:
+		return time.Now().Unix() + int64(cookie.MaxAge)
+	case cookie.MaxAge < 0:
+		return time.Now().Unix() - 1
+	case !cookie.Expires.IsZero():
+		return cookie.Expires.Unix()
+	}
+	return 0
+}
+
+// isExpired reports whether an expiry returned by cookieExpiry has passed.
+func isExpired(expiry int64) bool {
+	return expiry != 0 && time.Now().Unix() >= expiry
+}
+
+// mac computes the HMAC of a cookie name and value.
+func (signer *CookieSigner) mac(name, value string) []byte {
+	mac := hmac.New(sha256.New, signer.signingKey)
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+// isCookieNameValid reports whether name is a valid token as defined by RFC 6265.
+func isCookieNameValid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= 0x20 || c >= 0x7f || strings.IndexByte("()<>@,;:\\\"/[]?={}", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeCookieValue drops the bytes not allowed in a cookie value and quotes values
+// containing spaces or commas, as browsers accept them in that form.
+func sanitizeCookieValue(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 0x20 && c < 0x7f && c != '"' && c != ';' && c != '\\' {
+			builder.WriteByte(c)
+		}
+	}
+	sanitized := builder.String()
+	if strings.ContainsAny(sanitized, " ,") {
+		return `"` + sanitized + `"`
+	}
+	return sanitized
+}
+
+// sanitizeCookieAttribute drops the bytes that would end an attribute value early.
+func sanitizeCookieAttribute(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f || r == ';' {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignedCookieRoundTrip(t *testing.T) {
+	signer := NewCookieSigner(testSecret)
+	for _, value := range []string{"", "42", "user.42.admin", "a=b&c"} {
+		signed := signer.Sign(Cookie{Name: "session", Value: value, MaxAge: 3600})
+		if !strings.HasPrefix(signed.Value, value+".") {
+			t.Errorf("signed value %q does not start with the readable value %q", signed.Value, value)
+		}
+		got, err := signer.Verify(signed)
+		if err != nil || got != value {
+			t.Errorf("Verify(Sign(%q)) = %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestEncryptedCookieRoundTrip(t *testing.T) {
+	signer := NewCookieSigner(testSecret)
+	for _, value := range []string{"", "42", "user.42.admin", "a=b&c"} {
+		encrypted, err := signer.Encrypt(Cookie{Name: "session", Value: value, MaxAge: 3600})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "" && strings.Contains(encrypted.Value, value) {
+			t.Errorf("encrypted value %q contains the plaintext %q", encrypted.Value, value)
+		}
+		got, err := signer.Decrypt(encrypted)
+		if err != nil || got != value {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestSignedCookieTampering(t *testing.T) {
+	signer := NewCookieSigner(testSecret)
+	signed := signer.Sign(Cookie{Name: "role", Value: "user"})
+	expiryAndSignature := strings.TrimPrefix(signed.Value, "user")
+
+	tests := []struct {
+		name   string
+		cookie Cookie
+	}{
+		{"value", Cookie{Name: "role", Value: "admin" + expiryAndSignature}},
+		{"name", Cookie{Name: "other", Value: signed.Value}},
+		{"expiry", Cookie{Name: "role", Value: strings.Replace(signed.Value, ".0.", ".9999999999.", 1)}},
+		{"signature", Cookie{Name: "role", Value: signed.Value[:len(signed.Value)-1] + "A"}},
+		{"unsigned", Cookie{Name: "role", Value: "user"}},
+		{"wrong secret", *NewCookieSigner([]byte("another secret of thirty-two byte")).Sign(Cookie{Name: "role", Value: "user"})},
+	}
+	for _, test := range tests {
+		if _, err := signer.Verify(&test.cookie); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: Verify(%q) error = %v, want ErrInvalidSignature", test.name, test.cookie.Value, err)
+		}
+	}
+}
+
+func TestEncryptedCookieTampering(t *testing.T) {
+	signer := NewCookieSigner(testSecret)
+	encrypted, err := signer.Encrypt(Cookie{Name: "role", Value: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner := NewCookieSigner([]byte("another secret of thirty-two byte"))
+	otherEncrypted, err := otherSigner.Encrypt(Cookie{Name: "role", Value: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := []byte(encrypted.Value)
+	flipped[len(flipped)/2] ^= 1
+
+	tests := []struct {
+		name   string
+		cookie Cookie
+	}{
+		{"ciphertext", Cookie{Name: "role", Value: string(flipped)}},
+		{"name", Cookie{Name: "other", Value: encrypted.Value}},
+		{"truncated", Cookie{Name: "role", Value: encrypted.Value[:10]}},
+		{"not base64", Cookie{Name: "role", Value: "user"}},
+		{"wrong secret", *otherEncrypted},
+	}
+	for _, test := range tests {
+		if _, err := signer.Decrypt(&test.cookie); !errors.Is(err, ErrInvalidCookie) {
+			t.Errorf("%s: Decrypt(%q) error = %v, want ErrInvalidCookie", test.name, test.cookie.Value, err)
+		}
+	}
+}
+
+func TestCookieExpiry(t *testing.T) {
+	signer := NewCookieSigner(testSecret)
+	tests := []struct {
+		name    string
+		cookie  Cookie
+		expired bool
+	}{
+		{"session", Cookie{Name: "id", Value: "42"}, false},
+		{"future Expires", Cookie{Name: "id", Value: "42", Expires: time.Now().Add(time.Hour)}, false},
+		{"past Expires", Cookie{Name: "id", Value: "42", Expires: time.Now().Add(-time.Minute)}, true},
+		{"positive MaxAge", Cookie{Name: "id", Value: "42", MaxAge: 60}, false},
+		{"negative MaxAge", Cookie{Name: "id", Value: "42", MaxAge: -1}, true},
+		{"MaxAge before Expires", Cookie{Name: "id", Value: "42", MaxAge: 60, Expires: time.Now().Add(-time.Minute)}, false},
+	}
+	for _, test := range tests {
+		want := error(nil)
+		if test.expired {
+			want = ErrCookieExpired
+		}
+		if _, err := signer.Verify(signer.Sign(test.cookie)); !errors.Is(err, want) {
+			t.Errorf("%s: Verify error = %v, want %v", test.name, err, want)
+		}
+		encrypted, err := signer.Encrypt(test.cookie)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := signer.Decrypt(encrypted); !errors.Is(err, want) {
+			t.Errorf("%s: Decrypt error = %v, want %v", test.name, err, want)
+		}
+	}
+}
+
+func TestRequestSignedAndEncryptedCookies(t *testing.T) {
+	signer := NewCookieSigner(testSecret)
+	encrypted, err := signer.Encrypt(Cookie{Name: "token", Value: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := Header{}
+	headers.Set("Cookie", signer.Sign(Cookie{Name: "id", Value: "42"}).String()+"; "+encrypted.String())
+	request := Request{Headers: headers}
+
+	if _, err := request.SignedCookie("id"); !errors.Is(err, ErrNoCookieSigner) {
+		t.Errorf("SignedCookie without signer error = %v, want ErrNoCookieSigner", err)
+	}
+	request = CookieSignerKey.Set(request, signer)
+	if value, err := request.SignedCookie("id"); err != nil || value != "42" {
+		t.Errorf("SignedCookie = %q, %v, want 42", value, err)
+	}
+	if value, err := request.EncryptedCookie("token"); err != nil || value != "secret" {
+		t.Errorf("EncryptedCookie = %q, %v, want secret", value, err)
+	}
+	if _, err := request.SignedCookie("missing"); !errors.Is(err, ErrNoCookie) {
+		t.Errorf("SignedCookie of a missing cookie error = %v, want ErrNoCookie", err)
+	}
+}
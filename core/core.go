@@ -1,34 +1,66 @@
 package core
 
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
 // Module represents a core module in Sprint, which can contain other modules, controllers, and routes.
 type Module struct {
 	Name        string        // Unique identifier for the module.
-	Imports     []*Module     // Other modules that this module depends on.
+	Imports     []*Module     // Other modules that this module depends on. Their providers are started, their controllers are not mounted.
 	Exports     []*Module     // Sub-modules that this module provides to the outside world.
 	Controllers []*Controller // Controllers associated with this module.
+	Providers   []Provider    // Long-lived services started and stopped with the server, e.g., a WebSocket hub.
+}
+
+// Provider is a long-lived service owned by a module. The server starts the providers of every resolved module
+// before accepting connections, and stops them in reverse order on Shutdown.
+type Provider interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Drainer is implemented by providers that prepare for a shutdown while the server still accepts connections,
+// e.g., by failing readiness probes. The server drains them when Shutdown starts, before closing its listeners.
+type Drainer interface {
+	Drain(ctx context.Context)
 }
 
 // Controller handles incoming HTTP requests and routes them to their respective handler functions.
 type Controller struct {
-	Name   string   // Name of the controller.
-	Path   string   // Base path to which this controller's routes will be appended.
-	Routes []*Route // Routes defined for this controller.
+	Name        string       // Name of the controller.
+	Path        string       // Base path to which this controller's routes will be appended.
+	Routes      []*Route     // Routes defined for this controller.
+	Middlewares []Middleware // Middlewares applied to every route of this controller.
 }
 
 // AddRoute is a method to add new routes to a Controller.
-func (controller *Controller) AddRoute(method HttpMethod, endpoint string, handler func(request Request) Response) {
+// It returns the created Route so per-route options such as Timeout can be set on it.
+func (controller *Controller) AddRoute(method HttpMethod, endpoint string, handler func(request Request) Response) *Route {
 	if controller.Routes == nil {
 		controller.Routes = []*Route{}
 	}
 	// Adds a new Route to the Controller's Routes slice.
-	controller.Routes = append(controller.Routes, &Route{Endpoint: endpoint, Method: method, Function: handler})
+	route := &Route{Endpoint: endpoint, Method: method, Function: handler}
+	controller.Routes = append(controller.Routes, route)
+	return route
+}
+
+// Use appends middlewares that wrap every route of the Controller, in the order they are given.
+func (controller *Controller) Use(middlewares ...Middleware) {
+	controller.Middlewares = append(controller.Middlewares, middlewares...)
 }
 
 // Route defines a single route, its method, endpoint, and the handler function.
 type Route struct {
-	Method   HttpMethod                     // HTTP method (GET, POST, etc.)
-	Endpoint string                         // Endpoint path for the route.
-	Function func(request Request) Response // Handler function to execute when the route is accessed.
+	Method       HttpMethod                     // HTTP method (GET, POST, etc.)
+	Endpoint     string                         // Endpoint path for the route.
+	Function     func(request Request) Response // Handler function to execute when the route is accessed.
+	Timeout      time.Duration                  // Maximum duration of the handler before its context is cancelled (0 means no limit); streamed bodies are not bounded.
+	Heartbeat    time.Duration                  // Interval between keep-alive comments of SSE routes (see AddSSERoute).
+	MaxBodyBytes int64                          // Maximum size of the request body, answered with 413 when exceeded (0 uses the server limit, negative means no limit).
 }
 
 // Request represents the HTTP request data received by the server.
@@ -37,29 +69,45 @@ type Request struct {
 	Endpoint string            // Target endpoint of the request.
 	Protocol string            // Protocol used for the request, e.g., HTTP, HTTPS.
 	Params   map[string]string // URL parameters.
-	Headers  map[string]string // HTTP headers.
+	Headers  Header            // HTTP headers.
 	Query    []string          // Query parameters.
 	Body     interface{}       // Request body.
-	// TODO : ADD METADATA
+	RawBody  []byte            // Unparsed request body, as received.
+
+	ID            string               // Unique identifier of the request, taken from X-Request-ID or generated.
+	RemoteAddr    string               // Network address of the client, e.g., "192.0.2.1:51234".
+	LocalAddr     string               // Local network address on which the request was received.
+	TLS           *tls.ConnectionState // State of the TLS connection, nil for plain HTTP requests.
+	StartTime     time.Time            // Time at which the server started reading the request.
+	RequestURI    string               // Unmodified request target of the request line, e.g., "/users?id=1".
+	Route         string               // Template of the matched route, e.g., "users/:id", set before the middlewares run.
+	ContentLength int64                // Length of the request body in bytes.
+
+	ctx context.Context // Request context, see Context and WithContext.
 }
 
 // Response represents the structure of the HTTP response to be sent back to the client.
 type Response struct {
-	Content     interface{}       // Content of the response (could be a string, JSON, etc.)
-	ContentType ContentType       // Type of the content, e.g., application/json.
-	StatusCode  int               // HTTP status code, e.g., 200 (OK), 404 (Not Found), etc.
-	StatusText  string            // Textual representation of the status code.
-	Headers     map[string]string // Response headers.
+	Content     interface{} // Content of the response (could be a string, JSON, an io.Reader streamed to the client, etc.)
+	ContentType ContentType // Type of the content, e.g., application/json.
+	StatusCode  int         // HTTP status code, e.g., 200 (OK), 404 (Not Found), etc.
+	StatusText  string      // Textual representation of the status code.
+	Headers     Header      // Response headers.
+	Stream      StreamFunc  // Optional function writing the body incrementally, used instead of Content.
+	Hijack      HijackFunc  // Optional function taking over the connection after the headers, used instead of Content.
 }
 
 // EndpointNode is a structure used in Sprint's internal routing mechanism to map
 // endpoint strings to their corresponding handler functions.
 type EndpointNode struct {
-	Endpoint    string                         // Endpoint path.
-	Function    func(request Request) Response // Handler function for the endpoint.
-	DynamicNode *EndpointNode                  // Pointer to a node representing a dynamic segment in the route.
-	NextNodeMap map[string]*EndpointNode       // Map of next possible nodes in the route tree.
-	Level       int                            // Depth level of the node in the route tree.
+	Endpoint     string                         // Endpoint path.
+	Function     func(request Request) Response // Handler function for the endpoint.
+	DynamicNode  *EndpointNode                  // Pointer to a node representing a dynamic segment in the route.
+	WildcardNode *EndpointNode                  // Pointer to a node representing a final "*" segment, matching the rest of the path.
+	NextNodeMap  map[string]*EndpointNode       // Map of next possible nodes in the route tree.
+	Level        int                            // Depth level of the node in the route tree.
+	MaxBodyBytes int64                          // Maximum size of the request body of the route, see Route.MaxBodyBytes.
+	Route        string                         // Full template of the route ending at the node, e.g., "users/:id".
 }
 
 // HttpMethod represents the type for various HTTP methods used in web requests.
@@ -73,6 +121,10 @@ const (
 	PUT    HttpMethod = "PUT"    // PUT method for HTTP requests, often used for updating or replacing resources.
 	DELETE HttpMethod = "DELETE" // DELETE method for HTTP requests, used for deleting resources.
 	PATCH  HttpMethod = "PATCH"  // PATCH method for HTTP requests, applied for partially updating resources.
+	// HEAD method for HTTP requests, answered like GET without a body.
+	HEAD HttpMethod = "HEAD"
+	// OPTIONS method for HTTP requests, used to discover the allowed methods, e.g., by CORS preflight requests.
+	OPTIONS HttpMethod = "OPTIONS"
 )
 
 // ContentType defines the MIME type of the content being sent or received in HTTP transactions.
@@ -81,7 +133,8 @@ type ContentType string
 // Constants for various ContentType. These values are used to set the 'Content-Type'
 // header in HTTP responses and to interpret the content type of HTTP requests.
 const (
-	HTML      ContentType = "text/html"        // HTML content type, used for sending HTML-formatted data.
-	JSON      ContentType = "application/json" // JSON content type, used for sending JSON-formatted data.
-	PLAINTEXT ContentType = "text/plain"       // PlainText content type, used for sending plain text data.
+	HTML        ContentType = "text/html"         // HTML content type, used for sending HTML-formatted data.
+	JSON        ContentType = "application/json"  // JSON content type, used for sending JSON-formatted data.
+	PLAINTEXT   ContentType = "text/plain"        // PlainText content type, used for sending plain text data.
+	EVENTSTREAM ContentType = "text/event-stream" // EventStream content type, used for Server-Sent Events.
 )
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"net/textproto"
+	"sort"
+)
+
+// Header represents the HTTP headers of a request or a response.
+// Keys are stored in canonical form (e.g., "content-type" becomes "Content-Type") and a key
+// may hold several values, one per header line, as with Set-Cookie or repeated Accept lines.
+type Header map[string][]string
+
+// CanonicalHeaderKey returns the canonical form of a header key, e.g., "x-request-id" becomes "X-Request-Id".
+func CanonicalHeaderKey(key string) string {
+	return textproto.CanonicalMIMEHeaderKey(key)
+}
+
+// Add appends a value to the values associated with the key.
+func (header Header) Add(key, value string) {
+	key = CanonicalHeaderKey(key)
+	header[key] = append(header[key], value)
+}
+
+// Set replaces any existing values associated with the key by a single value.
+func (header Header) Set(key, value string) {
+	header[CanonicalHeaderKey(key)] = []string{value}
+}
+
+// Get returns the first value associated with the key, or "" if there is none.
+func (header Header) Get(key string) string {
+	values := header[CanonicalHeaderKey(key)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Values returns all the values associated with the key. The returned slice must not be modified.
+func (header Header) Values(key string) []string {
+	return header[CanonicalHeaderKey(key)]
+}
+
+// Has reports whether at least one value is associated with the key.
+func (header Header) Has(key string) bool {
+	return len(header[CanonicalHeaderKey(key)]) > 0
+}
+
+// Del removes the values associated with the key.
+func (header Header) Del(key string) {
+	delete(header, CanonicalHeaderKey(key))
+}
+
+// Clone returns a deep copy of the header, or nil if the header is nil.
+func (header Header) Clone() Header {
+	if header == nil {
+		return nil
+	}
+	clone := make(Header, len(header))
+	for key, values := range header {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// Keys returns the keys of the header in sorted order, so that serialization is deterministic.
+func (header Header) Keys() []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Header returns the response headers, allocating them first if needed, so that
+// Add and Set can be called on a Response built without headers.
+func (response *Response) Header() Header {
+	if response.Headers == nil {
+		response.Headers = make(Header)
+	}
+	return response.Headers
+}
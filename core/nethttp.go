@@ -0,0 +1,274 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Handle adds a route served by an http.Handler, e.g., a handler of a net/http library.
+func (controller *Controller) Handle(method HttpMethod, endpoint string, handler http.Handler) *Route {
+	return controller.AddRoute(method, endpoint, HTTPHandler(handler))
+}
+
+// Mount serves every request whose path starts with prefix, whatever its method, by an http.Handler.
+// The handler receives the full request path; use http.StripPrefix to remove the prefix.
+// The rest of the path is available to Sprint middlewares as the "*" parameter.
+func (controller *Controller) Mount(prefix string, handler http.Handler) []*Route {
+	endpoint := "*"
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		endpoint = prefix + "/*"
+	}
+	function := HTTPHandler(handler)
+	var routes []*Route
+	for _, method := range []HttpMethod{GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS} {
+		routes = append(routes, controller.AddRoute(method, endpoint, function))
+	}
+	return routes
+}
+
+// HTTPHandler adapts an http.Handler to a route handler function.
+// The response is buffered until the handler returns, unless it flushes it through http.Flusher,
+// in which case it is streamed; http.Hijacker is supported on HTTP/1 connections.
+func HTTPHandler(handler http.Handler) func(request Request) Response {
+	return func(request Request) Response {
+		httpRequest, err := request.httpRequest()
+		if err != nil {
+			return Response{Content: err.Error(), ContentType: PLAINTEXT, StatusCode: 400, StatusText: "Bad Request"}
+		}
+		writer := &httpResponseWriter{header: make(http.Header), ctx: httpRequest.Context(), ready: make(chan struct{}), done: make(chan struct{}), conns: make(chan net.Conn)}
+		go func() {
+			defer close(writer.done)
+			defer func() {
+				// A panic is raised again by the route handler while the response is pending, as for native handlers.
+				if recovered := recover(); recovered != nil {
+					writer.mutex.Lock()
+					writer.panicked, writer.err = recovered, fmt.Errorf("core: http.Handler panicked: %v", recovered)
+					writer.mutex.Unlock()
+				}
+			}()
+			handler.ServeHTTP(writer, httpRequest)
+		}()
+
+		select {
+		case <-writer.done:
+			if writer.panicked != nil && writer.panicked != http.ErrAbortHandler {
+				panic(writer.panicked)
+			}
+			return writer.bufferedResponse()
+		case <-writer.ready:
+		}
+		if writer.hijacked {
+			return Response{Hijack: writer.hijack}
+		}
+		return writer.streamedResponse()
+	}
+}
+
+// httpRequest converts the request into an *http.Request sharing its context.
+func (request Request) httpRequest() (*http.Request, error) {
+	target := request.RequestURI
+	if target == "" {
+		target = "/" + request.Endpoint
+		if len(request.Query) > 0 {
+			target += "?" + strings.Join(request.Query, "&")
+		}
+	}
+	body := request.RawBody
+	if body == nil && request.Body != nil {
+		switch content := request.Body.(type) {
+		case string:
+			body = []byte(content)
+		case []byte:
+			body = content
+		default:
+			var err error
+			if body, err = json.Marshal(content); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	httpRequest, err := http.NewRequestWithContext(request.Context(), request.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.RequestURI = target
+	httpRequest.Header = http.Header(request.Headers.Clone())
+	if httpRequest.Header == nil {
+		httpRequest.Header = make(http.Header)
+	}
+	// As for requests of net/http servers, the Host header is moved to the Host field.
+	httpRequest.Host = httpRequest.Header.Get("Host")
+	httpRequest.Header.Del("Host")
+	if major, minor, ok := http.ParseHTTPVersion(request.Protocol); ok {
+		httpRequest.Proto, httpRequest.ProtoMajor, httpRequest.ProtoMinor = request.Protocol, major, minor
+	}
+	httpRequest.RemoteAddr = request.RemoteAddr
+	httpRequest.TLS = request.TLS
+	return httpRequest, nil
+}
+
+// httpResponseWriter is the http.ResponseWriter given to adapted http.Handlers.
+// It buffers the response until the handler returns, flushes or hijacks the connection.
+type httpResponseWriter struct {
+	header http.Header
+	ctx    context.Context // Context of the request, ends a pending Hijack.
+
+	mutex      sync.Mutex
+	status     int
+	body       bytes.Buffer
+	stream     StreamWriter // Destination of the writes once the response is streamed.
+	hijacked   bool
+	panicked   interface{}
+	err        error
+	ready      chan struct{} // Closed on the first Flush or Hijack, when the response must be returned before the handler.
+	readyOnce  sync.Once
+	done       chan struct{} // Closed when the handler returns.
+	conns      chan net.Conn // Passes the hijacked connection to Hijack.
+	reader     *bufio.Reader
+	headerSent http.Header // Headers at the time the response was committed.
+}
+
+// Header returns the headers of the response.
+func (writer *httpResponseWriter) Header() http.Header {
+	return writer.header
+}
+
+// WriteHeader sets the status code of the response; later calls are ignored.
+func (writer *httpResponseWriter) WriteHeader(statusCode int) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.writeHeaderLocked(statusCode)
+}
+
+func (writer *httpResponseWriter) writeHeaderLocked(statusCode int) {
+	if writer.status != 0 {
+		return
+	}
+	writer.status = statusCode
+	writer.headerSent = writer.header.Clone()
+}
+
+// Write buffers p, or writes it to the client once the response is streamed.
+func (writer *httpResponseWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.hijacked {
+		return 0, http.ErrHijacked
+	}
+	writer.writeHeaderLocked(http.StatusOK)
+	if writer.stream != nil {
+		return writer.stream.Write(p)
+	}
+	return writer.body.Write(p)
+}
+
+// Flush switches the response to streaming and sends the written data to the client.
+func (writer *httpResponseWriter) Flush() {
+	writer.mutex.Lock()
+	writer.writeHeaderLocked(http.StatusOK)
+	stream := writer.stream
+	if stream != nil {
+		stream.Flush()
+	}
+	writer.mutex.Unlock()
+	writer.readyOnce.Do(func() { close(writer.ready) })
+}
+
+// Hijack hands the connection over to the handler once the route handler has returned.
+// The connection must be closed by the handler.
+func (writer *httpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	writer.mutex.Lock()
+	if writer.status != 0 || writer.hijacked {
+		writer.mutex.Unlock()
+		return nil, nil, errors.New("core: Hijack called after the response was written")
+	}
+	writer.hijacked = true
+	writer.mutex.Unlock()
+	writer.readyOnce.Do(func() { close(writer.ready) })
+
+	select {
+	case conn := <-writer.conns:
+		return conn, bufio.NewReadWriter(writer.reader, bufio.NewWriter(conn)), nil
+	case <-writer.ctx.Done():
+		return nil, nil, http.ErrNotSupported
+	}
+}
+
+// hijack is the HijackFunc of hijacked responses. It passes the connection to Hijack,
+// then keeps it open until the handler closes it.
+func (writer *httpResponseWriter) hijack(conn net.Conn, reader *bufio.Reader) {
+	hijackedConn := &hijackedConn{Conn: conn, closed: make(chan struct{})}
+	writer.reader = reader
+	select {
+	case writer.conns <- hijackedConn:
+	case <-writer.done:
+		return
+	}
+	<-hijackedConn.closed
+}
+
+// bufferedResponse returns the response of a handler that returned without flushing.
+func (writer *httpResponseWriter) bufferedResponse() Response {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.writeHeaderLocked(http.StatusOK)
+	header := writer.committedHeader()
+	return Response{Content: writer.body.String(), StatusCode: writer.status, StatusText: http.StatusText(writer.status), Headers: header}
+}
+
+// streamedResponse returns a response whose Stream sends the data written so far,
+// then the data written by the handler until it returns.
+func (writer *httpResponseWriter) streamedResponse() Response {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	header := writer.committedHeader()
+	return Response{StatusCode: writer.status, StatusText: http.StatusText(writer.status), Headers: header, Stream: func(stream StreamWriter) error {
+		writer.mutex.Lock()
+		_, err := stream.Write(writer.body.Bytes())
+		if err == nil {
+			err = stream.Flush()
+		}
+		writer.body.Reset()
+		writer.stream = stream
+		writer.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		<-writer.done
+		writer.mutex.Lock()
+		defer writer.mutex.Unlock()
+		return writer.err
+	}}
+}
+
+// committedHeader returns the headers of the response, with a Content-Type sniffed
+// from the body when the handler did not set one, as net/http does.
+func (writer *httpResponseWriter) committedHeader() Header {
+	header := Header(writer.headerSent)
+	if !header.Has("Content-Type") && writer.body.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(writer.body.Bytes()))
+	}
+	return header
+}
+
+// hijackedConn is a hijacked connection reporting when the handler closes it.
+type hijackedConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Close closes the connection.
+func (conn *hijackedConn) Close() error {
+	conn.once.Do(func() { close(conn.closed) })
+	return conn.Conn.Close()
+}
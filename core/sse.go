@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeat is the interval between keep-alive comments of SSE routes that do not set Route.Heartbeat.
+const DefaultHeartbeat = 15 * time.Second
+
+// Event is a Server-Sent Event, as sent by EventStream.Send.
+type Event struct {
+	ID    string        // Event ID, sent back by the client in the Last-Event-ID header when it reconnects.
+	Event string        // Event type, "message" for clients when empty.
+	Data  string        // Event payload. Multi-line data is sent as several data fields.
+	Retry time.Duration // Reconnection delay requested to the client, omitted when zero.
+}
+
+// EventStream is the connection of an SSE client. It is safe for concurrent use.
+type EventStream struct {
+	LastEventID string // Value of the Last-Event-ID header sent by a reconnecting client.
+
+	mutex  sync.Mutex
+	writer StreamWriter
+	ctx    context.Context
+}
+
+// Done returns a channel closed when the client disconnects or the stream is stopped.
+func (stream *EventStream) Done() <-chan struct{} {
+	return stream.ctx.Done()
+}
+
+// Send writes an event and flushes it to the client.
+func (stream *EventStream) Send(event Event) error {
+	var builder strings.Builder
+	if event.ID != "" {
+		builder.WriteString("id: " + removeLineBreaks(event.ID) + "\n")
+	}
+	if event.Event != "" {
+		builder.WriteString("event: " + removeLineBreaks(event.Event) + "\n")
+	}
+	if event.Retry > 0 {
+		builder.WriteString(fmt.Sprintf("retry: %d\n", event.Retry.Milliseconds()))
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\n") {
+		builder.WriteString("data: " + line + "\n")
+	}
+	builder.WriteString("\n")
+	return stream.write(builder.String())
+}
+
+// Comment writes a comment line, ignored by clients. Comments are used as heartbeats.
+func (stream *EventStream) Comment(text string) error {
+	return stream.write(": " + removeLineBreaks(text) + "\n\n")
+}
+
+func (stream *EventStream) write(frame string) error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if err := stream.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := stream.writer.Write([]byte(frame)); err != nil {
+		return err
+	}
+	return stream.writer.Flush()
+}
+
+// AddSSERoute adds a GET route serving Server-Sent Events. The connection stays open while the handler runs:
+// the handler sends events on the stream and should return once stream.Done() is closed, which happens when
+// the client disconnects. Heartbeat comments are sent every Route.Heartbeat (DefaultHeartbeat if unset).
+func (controller *Controller) AddSSERoute(endpoint string, handler func(request Request, stream *EventStream) error) *Route {
+	route := &Route{Endpoint: endpoint, Method: GET}
+	route.Function = func(request Request) Response {
+		headers := Header{}
+		headers.Set("Cache-Control", "no-cache")
+		headers.Set("X-Accel-Buffering", "no") // Disables buffering in reverse proxies such as nginx.
+		return Response{ContentType: EVENTSTREAM, Headers: headers, Stream: func(writer StreamWriter) error {
+			ctx, cancel := context.WithCancel(request.Context())
+			defer cancel()
+			stream := &EventStream{LastEventID: request.Headers.Get("Last-Event-ID"), writer: writer, ctx: ctx}
+
+			// Send the headers right away so that the client knows the stream is open.
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			go stream.heartbeat(route.Heartbeat, cancel)
+			return handler(request.WithContext(ctx), stream)
+		}}
+	}
+	controller.Routes = append(controller.Routes, route)
+	return route
+}
+
+// heartbeat sends a comment at every interval until the stream is done.
+// A failed write means the client is gone, so the stream is cancelled.
+func (stream *EventStream) heartbeat(interval time.Duration, cancel context.CancelFunc) {
+	if interval <= 0 {
+		interval = DefaultHeartbeat
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := stream.Comment("heartbeat"); err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// removeLineBreaks strips line breaks, which would end a field of an event early.
+func removeLineBreaks(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
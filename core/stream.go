@@ -0,0 +1,15 @@
+package core
+
+import "io"
+
+// StreamWriter is the writer given to Response.Stream functions.
+// Written data is buffered; Flush sends it to the client immediately.
+type StreamWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// StreamFunc produces the body of a streamed response by writing to the StreamWriter.
+// It runs after the handler has returned and the headers have been sent, so a returned error
+// can only abort the body. The request context stays usable to detect client disconnection.
+type StreamFunc func(writer StreamWriter) error
@@ -0,0 +1,12 @@
+package core
+
+import "crypto/x509"
+
+// ClientCertificate returns the leaf certificate presented by the client over mutual TLS,
+// or nil if the request was not made over TLS or without a client certificate.
+func (request Request) ClientCertificate() *x509.Certificate {
+	if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return request.TLS.PeerCertificates[0]
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/textproto"
+
+	"github.com/zlorgoncho1/sprint/websocket"
+)
+
+// HijackFunc takes over the connection once the response headers are sent, e.g., after a protocol upgrade.
+// The reader holds the data already received from the client. The connection is closed when the function returns.
+// When the StatusCode of the response is 0, no status line nor headers are sent: the function writes the whole response.
+type HijackFunc func(conn net.Conn, reader *bufio.Reader)
+
+// AddWebSocketRoute adds a GET route accepting WebSocket connections. The opening handshake is validated
+// according to the options, then the handler receives the message-oriented connection and owns it until it returns.
+// Requests that are not valid handshakes are answered with 400, 403 or 426.
+func (controller *Controller) AddWebSocketRoute(endpoint string, handler func(request Request, conn *websocket.Conn), options websocket.Options) *Route {
+	return controller.AddRoute(GET, endpoint, func(request Request) Response {
+		handshake, err := websocket.Accept(request.Method, textproto.MIMEHeader(request.Headers), options)
+		if err != nil {
+			response := Response{Content: err.Error(), ContentType: PLAINTEXT, StatusCode: 400, StatusText: "Bad Request"}
+			var handshakeErr *websocket.HandshakeError
+			if errors.As(err, &handshakeErr) {
+				response.StatusCode, response.StatusText = handshakeErr.Status, statusTexts[handshakeErr.Status]
+			}
+			if response.StatusCode == 426 {
+				response.Header().Set("Upgrade", "websocket")
+				response.Header().Set("Sec-WebSocket-Version", "13")
+			}
+			return response
+		}
+		return Response{StatusCode: 101, StatusText: "Switching Protocols", Headers: Header(handshake.Header), Hijack: func(conn net.Conn, reader *bufio.Reader) {
+			wsConn := websocket.NewConn(conn, reader, handshake, options)
+			defer wsConn.Close(websocket.CloseNormalClosure, "")
+			handler(request, wsConn)
+		}}
+	})
+}
+
+// statusTexts holds the status texts of the handshake errors.
+var statusTexts = map[int]string{
+	400: "Bad Request",
+	403: "Forbidden",
+	405: "Method Not Allowed",
+	426: "Upgrade Required",
+}
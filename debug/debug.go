@@ -0,0 +1,275 @@
+// Package debug serves runtime profiling and debug endpoints: pprof profiles, goroutine dumps, GC statistics,
+// build information and the route tree of the server. The module is opt-in and should not be exposed publicly.
+// It is served by a dedicated server, e.g., listening on localhost only:
+//
+//	srv := &server.Server{Port: "8000"}
+//	debugServer := &server.Server{Host: "127.0.0.1", Port: "6060"}
+//	go debugServer.Start(debug.Module(debug.Config{Server: srv}))
+//
+// or its controller is mounted next to the ones of the application, since only the controllers of the main
+// module are mounted:
+//
+//	mainModule.Controllers = append(mainModule.Controllers, debug.Controller(debug.Config{Server: srv, Secret: os.Getenv("DEBUG_SECRET")}))
+//
+// Requests are only served from localhost, or with the shared secret in the SecretHeader header,
+// and are answered with 403 otherwise. The endpoints, under the prefix, are:
+//
+//	GET  /debug              index of the endpoints
+//	GET  /debug/pprof/       pprof profiles, e.g., go tool pprof http://localhost:8000/debug/pprof/profile
+//	GET  /debug/goroutines   stacks of every goroutine, as text
+//	GET  /debug/gc           memory and GC statistics, as JSON; POST also runs a garbage collection first
+//	GET  /debug/build        build information of the binary, as JSON
+//	GET  /debug/routes       routes of the server, as JSON, or as an indented tree with ?format=tree
+package debug
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimedebug "runtime/debug"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/server"
+)
+
+// DefaultPrefix is the path of the endpoints when Config.Prefix is empty.
+const DefaultPrefix = "debug"
+
+// SecretHeader is the header carrying the shared secret.
+const SecretHeader = "X-Debug-Secret"
+
+// Config configures the debug module.
+type Config struct {
+	Prefix string         // Path under which the endpoints are served, DefaultPrefix when empty.
+	Server *server.Server // Server whose routes are listed by /routes, which is not served when nil.
+	Secret string         // Shared secret accepted in the SecretHeader header from any address; only localhost is allowed when empty.
+	// RequireSecret also requires the secret from localhost, e.g., when a reverse proxy on the same host
+	// makes every request come from localhost.
+	RequireSecret bool
+}
+
+// Module returns the debug module, whose only controller is the one returned by Controller.
+func Module(config Config) *core.Module {
+	return &core.Module{Name: "DebugModule", Controllers: []*core.Controller{Controller(config)}}
+}
+
+// Controller returns the controller of the debug endpoints, restricted by the Restrict middleware.
+func Controller(config Config) *core.Controller {
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	controller := &core.Controller{Name: "Debug", Path: prefix}
+	controller.Use(Restrict(config))
+
+	endpoints := []string{"pprof/", "goroutines", "gc", "build"}
+	if config.Server != nil {
+		endpoints = append(endpoints, "routes")
+	}
+	controller.AddRoute(core.GET, "", func(request core.Request) core.Response {
+		links := make(map[string]string, len(endpoints))
+		for _, endpoint := range endpoints {
+			links[strings.TrimSuffix(endpoint, "/")] = "/" + prefix + "/" + endpoint
+		}
+		return jsonResponse(map[string]interface{}{"endpoints": links})
+	})
+
+	// The index of pprof links to the profiles with relative URLs, so it is served with a trailing slash.
+	controller.AddRoute(core.GET, "pprof", func(request core.Request) core.Response {
+		response := core.Response{StatusCode: 301, StatusText: "Moved Permanently"}
+		response.Header().Set("Location", "/"+prefix+"/pprof/")
+		return response
+	})
+	profiles := core.HTTPHandler(http.HandlerFunc(servePprof))
+	controller.AddRoute(core.GET, "pprof/*", profiles)
+	controller.AddRoute(core.POST, "pprof/*", profiles) // pprof posts the addresses to resolve to symbol.
+
+	controller.AddRoute(core.GET, "goroutines", goroutines)
+	controller.AddRoute(core.GET, "gc", gcStats)
+	controller.AddRoute(core.POST, "gc", func(request core.Request) core.Response {
+		runtime.GC()
+		return gcStats(request)
+	})
+	controller.AddRoute(core.GET, "build", buildInfo)
+	if config.Server != nil {
+		controller.AddRoute(core.GET, "routes", routes(config.Server))
+	}
+	return controller
+}
+
+// Restrict returns a middleware answering 403 to requests that neither come from localhost nor carry the secret.
+func Restrict(config Config) core.Middleware {
+	return func(next core.Handler) core.Handler {
+		return func(request core.Request) core.Response {
+			if !allowed(config, request) {
+				request.Logger().Warn("Debug endpoint access denied", "remote_addr", request.RemoteAddr)
+				return core.Response{Content: "Forbidden", ContentType: core.PLAINTEXT, StatusCode: 403, StatusText: "Forbidden"}
+			}
+			return next(request)
+		}
+	}
+}
+
+// allowed reports whether the request may access the debug endpoints.
+func allowed(config Config, request core.Request) bool {
+	if config.Secret != "" {
+		secret := request.Headers.Get(SecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(config.Secret)) == 1 {
+			return true
+		}
+		if config.RequireSecret {
+			return false
+		}
+	}
+	return isLoopback(request.RemoteAddr)
+}
+
+// isLoopback reports whether the address, with or without a port, is a loopback address.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// servePprof serves the index of pprof, or the profile named by the rest of the path.
+func servePprof(w http.ResponseWriter, r *http.Request) {
+	_, name, _ := strings.Cut(r.URL.Path, "/pprof/")
+	switch name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// goroutines writes the stacks of every goroutine, in the format of an unrecovered panic.
+func goroutines(request core.Request) core.Response {
+	var body bytes.Buffer
+	runtimepprof.Lookup("goroutine").WriteTo(&body, 2)
+	return core.Response{Content: body.String(), ContentType: core.PLAINTEXT}
+}
+
+// gcStats returns the memory and GC statistics of the process.
+func gcStats(request core.Request) core.Response {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	var stats runtimedebug.GCStats
+	stats.PauseQuantiles = make([]time.Duration, 5)
+	runtimedebug.ReadGCStats(&stats)
+	quantiles := make(map[string]float64, len(stats.PauseQuantiles))
+	for index, name := range []string{"min", "p25", "p50", "p75", "max"} {
+		quantiles[name] = durationMilliseconds(stats.PauseQuantiles[index])
+	}
+	return jsonResponse(map[string]interface{}{
+		"goroutines":      runtime.NumGoroutine(),
+		"gomaxprocs":      runtime.GOMAXPROCS(0),
+		"num_gc":          stats.NumGC,
+		"last_gc":         stats.LastGC,
+		"pause_total_ms":  durationMilliseconds(stats.PauseTotal),
+		"pause_ms":        quantiles,
+		"gc_cpu_fraction": memStats.GCCPUFraction,
+		"heap_alloc":      memStats.HeapAlloc,
+		"heap_sys":        memStats.HeapSys,
+		"heap_idle":       memStats.HeapIdle,
+		"heap_inuse":      memStats.HeapInuse,
+		"heap_released":   memStats.HeapReleased,
+		"heap_objects":    memStats.HeapObjects,
+		"next_gc":         memStats.NextGC,
+		"total_alloc":     memStats.TotalAlloc,
+		"mallocs":         memStats.Mallocs,
+		"frees":           memStats.Frees,
+		"sys":             memStats.Sys,
+		"stack_inuse":     memStats.StackInuse,
+		"memory_limit":    runtimedebug.SetMemoryLimit(-1), // A negative limit only reads the current one.
+	})
+}
+
+// durationMilliseconds converts a duration to milliseconds.
+func durationMilliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+// buildInfo returns the build information of the binary.
+func buildInfo(request core.Request) core.Response {
+	info, ok := runtimedebug.ReadBuildInfo()
+	if !ok {
+		return core.Response{Content: "Build information unavailable", ContentType: core.PLAINTEXT, StatusCode: 404, StatusText: "Not Found"}
+	}
+	module := func(module *runtimedebug.Module) map[string]interface{} {
+		encoded := map[string]interface{}{"path": module.Path, "version": module.Version}
+		if module.Sum != "" {
+			encoded["sum"] = module.Sum
+		}
+		if module.Replace != nil {
+			encoded["replace"] = map[string]string{"path": module.Replace.Path, "version": module.Replace.Version}
+		}
+		return encoded
+	}
+	deps := make([]map[string]interface{}, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		deps = append(deps, module(dep))
+	}
+	settings := make(map[string]string, len(info.Settings))
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	return jsonResponse(map[string]interface{}{
+		"go_version": info.GoVersion,
+		"path":       info.Path,
+		"main":       module(&info.Main),
+		"deps":       deps,
+		"settings":   settings,
+		"goos":       runtime.GOOS,
+		"goarch":     runtime.GOARCH,
+	})
+}
+
+// routes returns a handler listing the routes of the server, or writing its route tree with ?format=tree.
+func routes(srv *server.Server) core.Handler {
+	return func(request core.Request) core.Response {
+		for _, parameter := range request.Query {
+			if parameter == "format=tree" {
+				var body bytes.Buffer
+				srv.WriteRouteTree(&body)
+				return core.Response{Content: body.String(), ContentType: core.PLAINTEXT}
+			}
+		}
+		resolved := srv.Routes()
+		encoded := make([]map[string]interface{}, 0, len(resolved))
+		for _, route := range resolved {
+			entry := map[string]interface{}{"method": route.Method, "path": route.Path, "controller": route.Controller}
+			if route.Timeout > 0 {
+				entry["timeout"] = route.Timeout.String()
+			}
+			if route.MaxBodyBytes != 0 {
+				entry["max_body_bytes"] = route.MaxBodyBytes
+			}
+			encoded = append(encoded, entry)
+		}
+		return jsonResponse(map[string]interface{}{"routes": encoded})
+	}
+}
+
+// jsonResponse encodes value as an indented JSON body.
+func jsonResponse(value interface{}) core.Response {
+	body, _ := json.MarshalIndent(value, "", "  ")
+	return core.Response{Content: json.RawMessage(body), ContentType: core.JSON}
+}
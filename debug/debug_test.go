@@ -0,0 +1,70 @@
+package debug_test
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/debug"
+	"github.com/zlorgoncho1/sprint/server"
+	"github.com/zlorgoncho1/sprint/sprinttest"
+)
+
+func TestRestrict(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     debug.Config
+		remoteAddr string
+		secret     string
+		allowed    bool
+	}{
+		{"loopback without a secret", debug.Config{}, "127.0.0.1:52000", "", true},
+		{"IPv6 loopback without a secret", debug.Config{}, "[::1]:52000", "", true},
+		{"loopback without the configured secret", debug.Config{Secret: "s3cret"}, "127.0.0.1:52000", "", true},
+		{"remote address without a secret", debug.Config{}, "203.0.113.7:52000", "", false},
+		{"remote address with a secret when none is configured", debug.Config{}, "203.0.113.7:52000", "s3cret", false},
+		{"remote address without the secret", debug.Config{Secret: "s3cret"}, "203.0.113.7:52000", "", false},
+		{"remote address with a wrong secret", debug.Config{Secret: "s3cret"}, "203.0.113.7:52000", "secret", false},
+		{"remote address with the secret", debug.Config{Secret: "s3cret"}, "203.0.113.7:52000", "s3cret", true},
+		{"invalid address", debug.Config{}, "localhost", "", false},
+		{"loopback with RequireSecret", debug.Config{Secret: "s3cret", RequireSecret: true}, "127.0.0.1:52000", "", false},
+		{"loopback with RequireSecret and a wrong secret", debug.Config{Secret: "s3cret", RequireSecret: true}, "127.0.0.1:52000", "s3cre", false},
+		{"loopback with RequireSecret and the secret", debug.Config{Secret: "s3cret", RequireSecret: true}, "127.0.0.1:52000", "s3cret", true},
+	}
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+	served := func(request core.Request) core.Response {
+		return core.Response{Content: "served", ContentType: core.PLAINTEXT}
+	}
+	for _, test := range tests {
+		handler := debug.Restrict(test.config)(served)
+		request := core.Request{RemoteAddr: test.remoteAddr, Headers: core.Header{}}
+		if test.secret != "" {
+			request.Headers.Set(debug.SecretHeader, test.secret)
+		}
+		response := handler(core.LoggerKey.Set(request, discard))
+		if allowed := response.StatusCode != 403; allowed != test.allowed {
+			t.Errorf("%s: answered %d %v, want allowed %v", test.name, response.StatusCode, response.Content, test.allowed)
+		}
+	}
+}
+
+func TestModule(t *testing.T) {
+	srv := &server.Server{}
+	app := sprinttest.NewWithServer(t, srv, debug.Module(debug.Config{Server: srv, Secret: "s3cret", Prefix: "/internal/"}))
+
+	// Requests of the test harness do not come from a loopback address.
+	app.Get("/internal/gc").Do().ExpectStatus(403)
+	app.Post("/internal/gc").Do().ExpectStatus(403)
+	app.Get("/internal/pprof/heap").Do().ExpectStatus(403)
+	app.Post("/internal/gc").Header(debug.SecretHeader, "s3cret").Do().
+		ExpectStatus(200).
+		ExpectHeader("Content-Type", "application/json").
+		ExpectBodyContains(`"num_gc"`)
+	app.Get("/internal/pprof").Header(debug.SecretHeader, "s3cret").Do().
+		ExpectStatus(301).
+		ExpectHeader("Location", "/internal/pprof/")
+	app.Get("/internal/routes").Query("format", "tree").Header(debug.SecretHeader, "s3cret").Do().
+		ExpectStatus(200).
+		ExpectBodyContains("gc => /internal/gc")
+}
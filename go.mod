@@ -1,10 +1,15 @@
 module github.com/zlorgoncho1/sprint
 
-go 1.20
+go 1.21
 
 require (
 	github.com/fatih/color v1.15.0
+	github.com/mattn/go-isatty v0.0.17
+	golang.org/x/net v0.35.0
+)
+
+require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.17 // indirect
-	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
 )
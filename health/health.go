@@ -0,0 +1,226 @@
+// Package health serves the liveness and readiness endpoints probed by orchestrators.
+//
+// A Health aggregates named checks contributed by any module, e.g., a database ping. Its controller serves
+// them from the main module, and the module returned by Module tracks the readiness of the instance:
+//
+//	checks := health.New()
+//	checks.AddCheck(health.Check{Name: "database", Timeout: time.Second, Check: db.PingContext})
+//	mainModule.Controllers = append(mainModule.Controllers, checks.Controller(""))
+//	mainModule.Imports = append(mainModule.Imports, checks.Module())
+//	srv := &server.Server{DrainDelay: 5 * time.Second}
+//
+// GET /healthz reports whether the process is alive, running only the checks marked Liveness.
+// GET /readyz reports whether the instance accepts traffic, running every check, and fails once the
+// instance is marked not ready. The server drains the Health when Shutdown starts, so /readyz fails
+// during Server.DrainDelay, before the listeners close.
+// Both answer 200 when the status is UP and 503 when it is DOWN, with a JSON Report.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+// DefaultTimeout is the maximum duration of a check when Check.Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+// Status is the outcome of a check or of a report.
+type Status string
+
+// Enumeration of Status.
+const (
+	UP   Status = "UP"   // The check passed.
+	DOWN Status = "DOWN" // The check failed or timed out.
+)
+
+// Check is a named health check.
+type Check struct {
+	Name    string                          // Name of the check in reports, unique within a Health.
+	Check   func(ctx context.Context) error // Returns an error when the dependency is unhealthy; ctx expires after Timeout.
+	Timeout time.Duration                   // Maximum duration of the check, DefaultTimeout when zero.
+	// Liveness also runs the check on /healthz. A failed liveness check gets the process restarted, so it should
+	// only fail for problems a restart fixes, e.g., a deadlock; checks of dependencies belong to /readyz only.
+	Liveness bool
+}
+
+// CheckResult is the outcome of a check in a report.
+type CheckResult struct {
+	Status   Status  `json:"status"`
+	Error    string  `json:"error,omitempty"` // Error returned by the check, or the timeout.
+	Duration float64 `json:"duration_ms"`     // Duration of the check in milliseconds.
+}
+
+// Report is the JSON body of the health endpoints.
+type Report struct {
+	Status  Status                 `json:"status"`            // UP when every check passed, DOWN otherwise.
+	Message string                 `json:"message,omitempty"` // Reason of a DOWN status not due to a check, e.g., "not ready".
+	Checks  map[string]CheckResult `json:"checks"`
+}
+
+// Health holds the checks of an application and its readiness. Its methods are safe for concurrent use.
+type Health struct {
+	mutex  sync.Mutex
+	checks []Check
+	ready  atomic.Bool
+}
+
+// New returns a Health without checks. It is not ready until the server starts its module, or SetReady is called.
+func New() *Health {
+	return &Health{}
+}
+
+// AddCheck registers a check. It panics when the name is empty or already registered, or when Check is nil.
+func (health *Health) AddCheck(check Check) {
+	if check.Name == "" || check.Check == nil {
+		panic("health: check without a name or a function")
+	}
+	health.mutex.Lock()
+	defer health.mutex.Unlock()
+	for _, registered := range health.checks {
+		if registered.Name == check.Name {
+			panic(fmt.Sprintf("health: check %q registered twice", check.Name))
+		}
+	}
+	health.checks = append(health.checks, check)
+}
+
+// SetReady marks the instance ready or not ready. Marking it not ready before a shutdown lets the
+// orchestrator stop sending traffic while in-flight requests complete.
+func (health *Health) SetReady(ready bool) {
+	health.ready.Store(ready)
+}
+
+// Ready reports whether the instance is marked ready.
+func (health *Health) Ready() bool {
+	return health.ready.Load()
+}
+
+// Start marks the instance ready, once the providers of the modules started before it are running.
+// It implements core.Provider.
+func (health *Health) Start(ctx context.Context) error {
+	health.SetReady(true)
+	return nil
+}
+
+// Drain marks the instance not ready when the server starts shutting down, while it still accepts connections.
+// It implements core.Drainer.
+func (health *Health) Drain(ctx context.Context) {
+	health.SetReady(false)
+}
+
+// Stop marks the instance not ready. It implements core.Provider.
+func (health *Health) Stop(ctx context.Context) error {
+	health.SetReady(false)
+	return nil
+}
+
+// Liveness runs the liveness checks and returns their report.
+func (health *Health) Liveness(ctx context.Context) Report {
+	return health.run(ctx, true)
+}
+
+// Readiness runs every check and returns their report, DOWN without running them when the instance is not ready.
+func (health *Health) Readiness(ctx context.Context) Report {
+	if !health.Ready() {
+		return Report{Status: DOWN, Message: "not ready", Checks: map[string]CheckResult{}}
+	}
+	return health.run(ctx, false)
+}
+
+// run runs the checks concurrently, only the liveness ones when liveness is set.
+func (health *Health) run(ctx context.Context, liveness bool) Report {
+	health.mutex.Lock()
+	checks := make([]Check, 0, len(health.checks))
+	for _, check := range health.checks {
+		if check.Liveness || !liveness {
+			checks = append(checks, check)
+		}
+	}
+	health.mutex.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wait sync.WaitGroup
+	for index, check := range checks {
+		wait.Add(1)
+		go func(index int, check Check) {
+			defer wait.Done()
+			results[index] = runCheck(ctx, check)
+		}(index, check)
+	}
+	wait.Wait()
+
+	report := Report{Status: UP, Checks: make(map[string]CheckResult, len(checks))}
+	for index, check := range checks {
+		report.Checks[check.Name] = results[index]
+		if results[index].Status == DOWN {
+			report.Status = DOWN
+		}
+	}
+	return report
+}
+
+// runCheck runs a check within its timeout. A check ignoring its context is abandoned once the timeout expires,
+// and a panic of the check is reported as a failure.
+func runCheck(ctx context.Context, check Check) CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+		done <- check.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	result := CheckResult{Status: UP, Duration: float64(time.Since(startTime).Microseconds()) / 1000}
+	if err != nil {
+		result.Status, result.Error = DOWN, err.Error()
+	}
+	return result
+}
+
+// Controller returns a controller serving /healthz and /readyz under the given path, e.g., "" for the root.
+func (health *Health) Controller(path string) *core.Controller {
+	controller := &core.Controller{Name: "Health", Path: path}
+	controller.AddRoute(core.GET, "healthz", func(request core.Request) core.Response {
+		return reportResponse(health.Liveness(request.Context()))
+	})
+	controller.AddRoute(core.GET, "readyz", func(request core.Request) core.Response {
+		return reportResponse(health.Readiness(request.Context()))
+	})
+	return controller
+}
+
+// Module returns a module to import, whose provider marks the instance ready when the server starts it
+// and not ready when the server starts shutting down. Its endpoints are served by adding Controller to the main module.
+func (health *Health) Module() *core.Module {
+	return &core.Module{Name: "HealthModule", Providers: []core.Provider{health}}
+}
+
+// reportResponse encodes a report, with status 503 when it is DOWN.
+func reportResponse(report Report) core.Response {
+	response := core.Response{Content: report, ContentType: core.JSON}
+	if report.Status == DOWN {
+		response.StatusCode, response.StatusText = 503, "Service Unavailable"
+	}
+	response.Header().Set("Cache-Control", "no-store")
+	return response
+}
@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy tells what an AsyncWriter does when its buffer is full.
+type OverflowPolicy int
+
+// Enumeration of OverflowPolicy.
+const (
+	Drop  OverflowPolicy = iota // The oldest buffered line is dropped, so that logging never slows down requests.
+	Block                       // Writes wait until the buffer has room, so that no line is lost.
+)
+
+// Default options of AsyncWriter.
+const (
+	DefaultAsyncBufferSize    = 1024
+	DefaultAsyncFlushInterval = time.Second
+)
+
+// errAsyncWriterClosed is returned by writes to a closed AsyncWriter.
+var errAsyncWriterClosed = errors.New("logger: write to closed AsyncWriter")
+
+// AsyncOptions configures an AsyncWriter.
+type AsyncOptions struct {
+	BufferSize    int            // Maximum number of buffered lines, DefaultAsyncBufferSize when zero.
+	Policy        OverflowPolicy // Behavior when the buffer is full, Drop when zero.
+	FlushInterval time.Duration  // Maximum time a written line stays in memory, DefaultAsyncFlushInterval when zero.
+}
+
+// AsyncWriter moves the writes of a Logger off the request path: lines are copied into a bounded ring buffer
+// and written to the underlying writer by a background goroutine, in batches. It is used as the Output of a Logger:
+//
+//	output := logger.NewAsyncWriter(os.Stdout, logger.AsyncOptions{})
+//	defer output.Close()
+//	srv := &server.Server{Logger: logger.Logger{Output: output}}
+//
+// Buffered lines are written on Flush and Close; Server.Shutdown flushes the Output of its Logger.
+type AsyncWriter struct {
+	writer  io.Writer
+	options AsyncOptions
+
+	mutex   sync.Mutex
+	notFull *sync.Cond // Signaled when lines are taken from the buffer, for the Block policy.
+	lines   [][]byte   // Ring buffer of lines.
+	head    int        // Index of the oldest line.
+	count   int        // Number of buffered lines.
+	flushes []chan error
+	closed  bool
+	dropped atomic.Uint64
+
+	wake chan struct{} // Wakes up the background goroutine, with a capacity of one.
+	done chan struct{} // Closed when the background goroutine returns.
+}
+
+// NewAsyncWriter returns an AsyncWriter writing to writer, and starts its background goroutine.
+func NewAsyncWriter(writer io.Writer, options AsyncOptions) *AsyncWriter {
+	if options.BufferSize <= 0 {
+		options.BufferSize = DefaultAsyncBufferSize
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = DefaultAsyncFlushInterval
+	}
+	asyncWriter := &AsyncWriter{
+		writer:  writer,
+		options: options,
+		lines:   make([][]byte, options.BufferSize),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	asyncWriter.notFull = sync.NewCond(&asyncWriter.mutex)
+	go asyncWriter.run()
+	return asyncWriter
+}
+
+// Write buffers a copy of p. It never fails because of the underlying writer, whose errors are returned by Flush.
+func (asyncWriter *AsyncWriter) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+	asyncWriter.mutex.Lock()
+	for asyncWriter.options.Policy == Block && asyncWriter.count == len(asyncWriter.lines) && !asyncWriter.closed {
+		asyncWriter.notFull.Wait()
+	}
+	if asyncWriter.closed {
+		asyncWriter.mutex.Unlock()
+		return 0, errAsyncWriterClosed
+	}
+	size := len(asyncWriter.lines)
+	if asyncWriter.count == size {
+		// The buffer is full: the oldest line is overwritten.
+		asyncWriter.head = (asyncWriter.head + 1) % size
+		asyncWriter.count--
+		asyncWriter.dropped.Add(1)
+	}
+	asyncWriter.lines[(asyncWriter.head+asyncWriter.count)%size] = line
+	asyncWriter.count++
+	asyncWriter.mutex.Unlock()
+	asyncWriter.signal()
+	return len(p), nil
+}
+
+// Flush writes the buffered lines to the underlying writer, and flushes it when it has a Flush method.
+// It returns the first error of the underlying writer since the previous Flush.
+func (asyncWriter *AsyncWriter) Flush() error {
+	result := make(chan error, 1)
+	asyncWriter.mutex.Lock()
+	if asyncWriter.closed {
+		asyncWriter.mutex.Unlock()
+		return nil
+	}
+	asyncWriter.flushes = append(asyncWriter.flushes, result)
+	asyncWriter.mutex.Unlock()
+	asyncWriter.signal()
+	return <-result
+}
+
+// Close writes the buffered lines, stops the background goroutine, and closes the underlying writer when
+// it is an io.Closer other than os.Stdout and os.Stderr. Later writes fail.
+func (asyncWriter *AsyncWriter) Close() error {
+	asyncWriter.mutex.Lock()
+	if asyncWriter.closed {
+		asyncWriter.mutex.Unlock()
+		<-asyncWriter.done
+		return nil
+	}
+	result := make(chan error, 1)
+	asyncWriter.flushes = append(asyncWriter.flushes, result)
+	asyncWriter.closed = true
+	asyncWriter.notFull.Broadcast()
+	asyncWriter.mutex.Unlock()
+	asyncWriter.signal()
+	<-asyncWriter.done
+	err := <-result
+	if closer, ok := asyncWriter.writer.(io.Closer); ok && closer != os.Stdout && closer != os.Stderr {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Dropped returns the number of lines dropped because the buffer was full.
+func (asyncWriter *AsyncWriter) Dropped() uint64 {
+	return asyncWriter.dropped.Load()
+}
+
+// signal wakes up the background goroutine, unless it is already about to wake up.
+func (asyncWriter *AsyncWriter) signal() {
+	select {
+	case asyncWriter.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take removes the buffered lines and the pending flush requests.
+func (asyncWriter *AsyncWriter) take() ([][]byte, []chan error, bool) {
+	asyncWriter.mutex.Lock()
+	defer asyncWriter.mutex.Unlock()
+	lines := make([][]byte, 0, asyncWriter.count)
+	size := len(asyncWriter.lines)
+	for ; asyncWriter.count > 0; asyncWriter.count-- {
+		lines = append(lines, asyncWriter.lines[asyncWriter.head])
+		asyncWriter.lines[asyncWriter.head] = nil
+		asyncWriter.head = (asyncWriter.head + 1) % size
+	}
+	flushes := asyncWriter.flushes
+	asyncWriter.flushes = nil
+	asyncWriter.notFull.Broadcast()
+	return lines, flushes, asyncWriter.closed
+}
+
+// run writes the buffered lines until the writer is closed. Lines are batched in a bufio.Writer,
+// flushed every FlushInterval and on request.
+func (asyncWriter *AsyncWriter) run() {
+	defer close(asyncWriter.done)
+	buffer := bufio.NewWriterSize(asyncWriter.writer, 64<<10)
+	ticker := time.NewTicker(asyncWriter.options.FlushInterval)
+	defer ticker.Stop()
+	var writeErr error
+	for {
+		timeout := false
+		select {
+		case <-asyncWriter.wake:
+		case <-ticker.C:
+			timeout = true
+		}
+		lines, flushes, closed := asyncWriter.take()
+		for _, line := range lines {
+			if _, err := buffer.Write(line); err != nil && writeErr == nil {
+				writeErr = err
+			}
+		}
+		if timeout || len(flushes) > 0 || closed {
+			if err := buffer.Flush(); err != nil {
+				if writeErr == nil {
+					writeErr = err
+				}
+				// A bufio.Writer keeps failing after an error: the lines it holds are dropped.
+				buffer.Reset(asyncWriter.writer)
+			}
+			if flusher, ok := asyncWriter.writer.(interface{ Flush() error }); ok && len(flushes) > 0 {
+				if err := flusher.Flush(); err != nil && writeErr == nil {
+					writeErr = err
+				}
+			}
+			if len(flushes) > 0 {
+				for _, flush := range flushes {
+					flush <- writeErr
+				}
+				writeErr = nil
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter records what is written to it, blocking writes while it is held.
+type blockingWriter struct {
+	mutex   sync.Mutex
+	buffer  bytes.Buffer
+	held    chan struct{} // Receives a value when a write starts while the writer is held.
+	release chan struct{} // Closed to release the writes.
+	closed  bool
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{held: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (writer *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case writer.held <- struct{}{}:
+	default:
+	}
+	<-writer.release
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.buffer.Write(p)
+}
+
+func (writer *blockingWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.closed = true
+	return nil
+}
+
+func (writer *blockingWriter) String() string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.buffer.String()
+}
+
+// holdAsyncWriter writes a line and flushes it in the background, returning once the background goroutine
+// of the AsyncWriter is blocked writing it, so that the following writes fill its buffer.
+func holdAsyncWriter(t *testing.T, asyncWriter *AsyncWriter, writer *blockingWriter) {
+	t.Helper()
+	asyncWriter.Write([]byte("0\n"))
+	go asyncWriter.Flush()
+	select {
+	case <-writer.held:
+	case <-time.After(time.Second):
+		t.Fatal("the buffered line was not written")
+	}
+}
+
+func TestAsyncWriterDrop(t *testing.T) {
+	writer := newBlockingWriter()
+	asyncWriter := NewAsyncWriter(writer, AsyncOptions{BufferSize: 2, Policy: Drop, FlushInterval: time.Hour})
+	holdAsyncWriter(t, asyncWriter, writer)
+
+	for _, line := range []string{"1\n", "2\n", "3\n"} {
+		if _, err := asyncWriter.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped := asyncWriter.Dropped(); dropped != 1 {
+		t.Errorf("Dropped() = %d, want 1", dropped)
+	}
+	close(writer.release)
+	if err := asyncWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The oldest buffered line is dropped.
+	if got := writer.String(); got != "0\n2\n3\n" {
+		t.Errorf("written %q, want %q", got, "0\n2\n3\n")
+	}
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	writer := newBlockingWriter()
+	asyncWriter := NewAsyncWriter(writer, AsyncOptions{BufferSize: 2, Policy: Block, FlushInterval: time.Hour})
+	holdAsyncWriter(t, asyncWriter, writer)
+
+	asyncWriter.Write([]byte("1\n"))
+	asyncWriter.Write([]byte("2\n"))
+	written := make(chan struct{})
+	go func() {
+		asyncWriter.Write([]byte("3\n"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("Write returned while the buffer is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(writer.release)
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Write is still blocked once the buffer has room")
+	}
+	if err := asyncWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := writer.String(); got != "0\n1\n2\n3\n" || asyncWriter.Dropped() != 0 {
+		t.Errorf("written %q with %d dropped lines, want %q", got, asyncWriter.Dropped(), "0\n1\n2\n3\n")
+	}
+}
+
+func TestAsyncWriterClose(t *testing.T) {
+	writer := newBlockingWriter()
+	close(writer.release)
+	asyncWriter := NewAsyncWriter(writer, AsyncOptions{FlushInterval: time.Hour})
+	asyncWriter.Write([]byte("first\n"))
+	asyncWriter.Write([]byte("second\n"))
+	if got := writer.String(); got != "" {
+		t.Errorf("written %q before Close, want nothing within FlushInterval", got)
+	}
+
+	if err := asyncWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := writer.String(); got != "first\nsecond\n" {
+		t.Errorf("written %q on Close, want every buffered line", got)
+	}
+	if !writer.closed {
+		t.Error("the underlying writer was not closed")
+	}
+	if _, err := asyncWriter.Write([]byte("late\n")); !errors.Is(err, errAsyncWriterClosed) {
+		t.Errorf("Write after Close returned %v, want errAsyncWriterClosed", err)
+	}
+}
@@ -0,0 +1,189 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Format is the encoding of the messages of a Logger.
+type Format int
+
+// Enumeration of Format.
+const (
+	TEXT   Format = iota // Colored, human-readable lines.
+	JSON                 // One JSON object per line.
+	LOGFMT               // One line of space-separated key=value pairs.
+)
+
+// formatNames holds the names of the formats, as accepted by ParseFormat.
+var formatNames = map[Format]string{TEXT: "TEXT", JSON: "JSON", LOGFMT: "LOGFMT"}
+
+// String returns the name of the format, e.g., "JSON".
+func (format Format) String() string {
+	if name, ok := formatNames[format]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(format))
+}
+
+// ParseFormat returns the format with the given name, case-insensitively, e.g., from an environment variable.
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for format, formatName := range formatNames {
+		if formatName == name {
+			return format, nil
+		}
+	}
+	return TEXT, errors.New("logger: unknown format " + name)
+}
+
+// Fields are structured key-value pairs attached to a message, e.g., {"user": 42}.
+// They are printed after the message in the TEXT format.
+type Fields map[string]interface{}
+
+// Keys of the fields written by every structured message.
+const (
+	TimeKey    = "time"
+	LevelKey   = "level"
+	ModuleKey  = "module"
+	MessageKey = "msg"
+)
+
+// merge returns the fields of both sets, the fields of other taking precedence.
+func (fields Fields) merge(other Fields) Fields {
+	if len(fields) == 0 {
+		return other
+	}
+	if len(other) == 0 {
+		return fields
+	}
+	merged := make(Fields, len(fields)+len(other))
+	for key, value := range fields {
+		merged[key] = value
+	}
+	for key, value := range other {
+		merged[key] = value
+	}
+	return merged
+}
+
+// sortedKeys returns the keys of the fields in alphabetical order, so that lines are stable.
+func (fields Fields) sortedKeys() []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		switch key {
+		case TimeKey, LevelKey, ModuleKey, MessageKey:
+			// Reserved keys are written first and cannot be overridden.
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldValue returns the value to encode for a field: errors, durations and times as strings, other values as they are.
+func fieldValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case error:
+		return typed.Error()
+	case time.Duration:
+		return typed.String()
+	case time.Time:
+		return typed.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// encodeJSON encodes a message as a JSON object, without a trailing newline.
+func encodeJSON(now time.Time, level Level, moduleName string, message interface{}, fields Fields) string {
+	var builder strings.Builder
+	builder.WriteByte('{')
+	writeJSONPair(&builder, TimeKey, now.Format(time.RFC3339Nano))
+	builder.WriteByte(',')
+	writeJSONPair(&builder, LevelKey, level.String())
+	builder.WriteByte(',')
+	writeJSONPair(&builder, ModuleKey, moduleName)
+	builder.WriteByte(',')
+	writeJSONPair(&builder, MessageKey, fmt.Sprint(message))
+	for _, key := range fields.sortedKeys() {
+		builder.WriteByte(',')
+		writeJSONPair(&builder, key, fieldValue(fields[key]))
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+// writeJSONPair writes "key":value, falling back to the string representation of values that cannot be encoded.
+func writeJSONPair(builder *strings.Builder, key string, value interface{}) {
+	builder.Write(marshalJSON(key))
+	builder.WriteByte(':')
+	encodedValue := marshalJSON(value)
+	if encodedValue == nil {
+		encodedValue = marshalJSON(fmt.Sprint(value))
+	}
+	builder.Write(encodedValue)
+}
+
+// marshalJSON encodes a value without escaping HTML characters, such as "==>" in messages; it returns nil on failure.
+func marshalJSON(value interface{}) []byte {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+}
+
+// encodeLogfmt encodes a message as logfmt pairs, without a trailing newline.
+func encodeLogfmt(now time.Time, level Level, moduleName string, message interface{}, fields Fields) string {
+	var builder strings.Builder
+	writeLogfmtPair(&builder, TimeKey, now.Format(time.RFC3339Nano))
+	writeLogfmtPair(&builder, LevelKey, level.String())
+	writeLogfmtPair(&builder, ModuleKey, moduleName)
+	writeLogfmtPair(&builder, MessageKey, fmt.Sprint(message))
+	writeLogfmtFields(&builder, fields)
+	return builder.String()
+}
+
+// writeLogfmtFields writes the fields as logfmt pairs, in alphabetical order.
+func writeLogfmtFields(builder *strings.Builder, fields Fields) {
+	for _, key := range fields.sortedKeys() {
+		writeLogfmtPair(builder, key, fieldValue(fields[key]))
+	}
+}
+
+// writeLogfmtPair writes key=value, separated from the previous pair by a space.
+func writeLogfmtPair(builder *strings.Builder, key string, value interface{}) {
+	if builder.Len() > 0 {
+		builder.WriteByte(' ')
+	}
+	builder.WriteString(logfmtString(key))
+	builder.WriteByte('=')
+	switch typed := value.(type) {
+	case nil:
+		builder.WriteString("null")
+	case string:
+		builder.WriteString(logfmtString(typed))
+	default:
+		builder.WriteString(logfmtString(fmt.Sprint(typed)))
+	}
+}
+
+// logfmtString quotes a string when it is empty or contains spaces, quotes, '=' or control characters.
+func logfmtString(value string) string {
+	if value == "" || strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || unicode.IsControl(r) || unicode.IsSpace(r)
+	}) >= 0 {
+		return strconv.Quote(value)
+	}
+	return value
+}
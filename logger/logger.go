@@ -1,15 +1,190 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
 )
 
-// Logger struct is an empty struct that serves as a receiver for logging methods.
-type Logger struct{}
+// Level is the severity of a log message.
+type Level int
+
+// Enumeration of Level, from the most to the least verbose.
+const (
+	DEBUG  Level = iota // Detailed messages for debugging.
+	LOG                 // General messages, e.g., mapped routes and handled requests.
+	WARN                // Unexpected situations that do not prevent the application from working.
+	ERROR               // Failures.
+	SILENT              // Disables every message when used as a minimum level.
+)
+
+// levelNames holds the names of the levels, as printed and as accepted by ParseLevel.
+var levelNames = map[Level]string{DEBUG: "DEBUG", LOG: "LOG", WARN: "WARN", ERROR: "ERROR", SILENT: "SILENT"}
+
+// String returns the name of the level, e.g., "WARN".
+func (level Level) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(level))
+}
+
+// ParseLevel returns the level with the given name, case-insensitively, e.g., from an environment variable.
+// "INFO" is accepted as an alias of LOG.
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "INFO" {
+		return LOG, nil
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return DEBUG, errors.New("logger: unknown level " + name)
+}
+
+// Interface is the set of logging methods used by the server, implemented by Logger.
+// Applications can provide their own implementation to send Sprint logs to another logging library.
+type Interface interface {
+	Debug(message interface{}, moduleName string)
+	Log(message interface{}, moduleName string)
+	Warn(message interface{}, moduleName string)
+	Error(message interface{}, moduleName string)
+	// Plog logs a timed message. statusCode is the class of an HTTP status, e.g., "4" for 404, logged at the WARN
+	// level for "4", the ERROR level for "5" and the LOG level otherwise, or "0" for messages that are not responses.
+	Plog(message interface{}, elapsed time.Duration, moduleName string, statusCode string, statusMessage string)
+}
+
+// FieldLogger is implemented by Logger and *Logger: it is asserted on an Interface to write structured fields
+// and to filter levels before formatting a message.
+type FieldLogger interface {
+	Interface
+	Enabled(level Level, moduleName string) bool
+	With(fields Fields) Logger
+	Structured() bool
+	LogFields(level Level, message interface{}, moduleName string, fields Fields)
+}
+
+// Logger writes log messages, as text or structured. Its zero value logs every message to os.Stdout as text,
+// colored when os.Stdout is a terminal.
+type Logger struct {
+	Level   Level            // Minimum level of the logged messages, DEBUG when zero.
+	Modules map[string]Level // Minimum level per module name, overriding Level, e.g., {"RequestHandler": logger.WARN}.
+	Output  io.Writer        // Destination of the messages, os.Stdout when nil.
+	Format  Format           // Encoding of the messages, TEXT when zero.
+	Fields  Fields           // Fields added to every message.
+	Handler slog.Handler     // Destination of the messages as slog records, with the module name and fields as attributes, instead of Output.
+
+	AppName   string    // Name of the application in the prefix of the TEXT format, "Sprint" when empty.
+	Env       string    // Environment of the application, e.g., "dev", "staging" or "prod"; DefaultEnv when empty.
+	Version   string    // Version in the prefix of the TEXT format, read from the build info of the binary when empty.
+	ColorMode ColorMode // When the TEXT format is colored, ColorAuto when zero.
+}
+
+// outputMutex serializes the writes of every Logger, so that Output does not need to be safe for concurrent use.
+var outputMutex sync.Mutex
+
+// Enabled reports whether messages of the level are logged for the module.
+func (l Logger) Enabled(level Level, moduleName string) bool {
+	if minLevel, ok := l.Modules[moduleName]; ok {
+		return level >= minLevel && minLevel != SILENT
+	}
+	return level >= l.Level && l.Level != SILENT
+}
+
+// With returns a copy of the logger adding the fields to every message.
+func (l Logger) With(fields Fields) Logger {
+	l.Fields = l.Fields.merge(fields)
+	return l
+}
+
+// Structured reports whether messages are written as structured records, to a slog handler or in the JSON or LOGFMT format.
+func (l Logger) Structured() bool {
+	return l.Handler != nil || l.Format != TEXT
+}
+
+// LogFields logs a message with structured fields at the given level.
+func (l Logger) LogFields(level Level, message interface{}, moduleName string, fields Fields) {
+	l = l.With(fields)
+	switch {
+	case level <= DEBUG:
+		l.Debug(message, moduleName)
+	case level == LOG:
+		l.Log(message, moduleName)
+	case level == WARN:
+		l.Warn(message, moduleName)
+	default:
+		l.Error(message, moduleName)
+	}
+}
+
+// structured writes a message to the slog handler, or in the JSON or LOGFMT format,
+// and reports whether the logger is structured.
+func (l Logger) structured(level Level, message interface{}, moduleName string, fields Fields) bool {
+	if l.Handler != nil {
+		l.handle(level, message, moduleName, l.appFields().merge(l.Fields).merge(fields))
+		return true
+	}
+	var line string
+	switch l.Format {
+	case JSON:
+		line = encodeJSON(time.Now(), level, moduleName, message, l.appFields().merge(l.Fields).merge(fields))
+	case LOGFMT:
+		line = encodeLogfmt(time.Now(), level, moduleName, message, l.appFields().merge(l.Fields).merge(fields))
+	default:
+		return false
+	}
+	l.println(line)
+	return true
+}
+
+// appFields returns the name and environment of the application as fields of structured messages, when they are set.
+func (l Logger) appFields() Fields {
+	if l.AppName == "" && l.Env == "" {
+		return nil
+	}
+	fields := Fields{}
+	if l.AppName != "" {
+		fields["app"] = l.AppName
+	}
+	if l.Env != "" {
+		fields["env"] = l.Env
+	}
+	return fields
+}
+
+// textMessage returns the message followed by the fields of the logger, as logfmt pairs, for the TEXT format.
+func (l Logger) textMessage(message interface{}) interface{} {
+	if len(l.Fields) == 0 {
+		return message
+	}
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprint(message))
+	writeLogfmtFields(&builder, l.Fields)
+	return builder.String()
+}
+
+// Flush writes the messages buffered by the output, when it has a Flush method, e.g., an AsyncWriter.
+func (l Logger) Flush() error {
+	if flusher, ok := l.output().(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// println writes a line to the output of the logger.
+func (l Logger) println(line string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintln(l.output(), line)
+}
 
 // colorMap maps string representations of colors to their corresponding color attributes
 var colorMap = map[string]color.Attribute{
@@ -25,7 +200,10 @@ var colorMap = map[string]color.Attribute{
 
 // Print simply prints a message without any additional formatting or coloring.
 func (l Logger) Print(message interface{}, moduleName string) {
-	fmt.Println(message)
+	if !l.Enabled(LOG, moduleName) || l.structured(LOG, message, moduleName, nil) {
+		return
+	}
+	l.println(fmt.Sprint(l.textMessage(message)))
 }
 
 // Color returns a SprintFunc that applies the specified text color.
@@ -34,65 +212,103 @@ func (l Logger) Color(__color string) func(a ...interface{}) string {
 	if !ok {
 		colorValue = color.FgWhite // Default to white if color not found.
 	}
-	return color.New(colorValue).SprintFunc()
+	c := color.New(colorValue)
+	if l.colored() {
+		c.EnableColor()
+	} else {
+		c.DisableColor()
+	}
+	return c.SprintFunc()
 }
 
 // Debug logs a message with the DEBUG level in a specific format, including time, level, module name, and message.
 func (l Logger) Debug(message interface{}, moduleName string) {
-	fmt.Println(
+	if !l.Enabled(DEBUG, moduleName) || l.structured(DEBUG, message, moduleName, nil) {
+		return
+	}
+	l.println(
 		fmt.Sprintf("%s %s %s %s %s",
-			l.Color("white")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("white")(l.prefix()),
 			l.Color("magenta")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("white")("DEBUG"),
 			l.Color("magenta")(fmt.Sprintf("[%s]", moduleName)),
-			l.Color("white")(message)),
+			l.Color("white")(l.textMessage(message))),
 	)
 }
 
 // Log logs a general message, with the LOG level.
 func (l Logger) Log(message interface{}, moduleName string) {
-	fmt.Println(
+	if !l.Enabled(LOG, moduleName) || l.structured(LOG, message, moduleName, nil) {
+		return
+	}
+	l.println(
 		fmt.Sprintf("%s %s %s %s %s",
-			l.Color("blue")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("blue")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("blue")("LOG"),
 			l.Color("green")(fmt.Sprintf("[%s]", moduleName)),
-			l.Color("blue")(message)),
+			l.Color("blue")(l.textMessage(message))),
 	)
 }
 
 // Warn logs a message with the WARN level.
 func (l Logger) Warn(message interface{}, moduleName string) {
-	fmt.Println(
+	if !l.Enabled(WARN, moduleName) || l.structured(WARN, message, moduleName, nil) {
+		return
+	}
+	l.println(
 		fmt.Sprintf("%s %s %s %s %s",
-			l.Color("yellow")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("yellow")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("yellow")("WARN"),
 			l.Color("white")(fmt.Sprintf("[%s]", moduleName)),
-			l.Color("yellow")(message)),
+			l.Color("yellow")(l.textMessage(message))),
 	)
 }
 
 // Error logs a message with the ERROR level.
 func (l Logger) Error(message interface{}, moduleName string) {
-	fmt.Println(
+	if !l.Enabled(ERROR, moduleName) || l.structured(ERROR, message, moduleName, nil) {
+		return
+	}
+	l.println(
 		fmt.Sprintf("%s %s %s %s %s",
-			l.Color("red")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("red")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("red")("ERROR"),
 			l.Color("white")(fmt.Sprintf("[%s]", moduleName)),
-			l.Color("red")(message)),
+			l.Color("red")(l.textMessage(message))),
 	)
 }
 
 // Plog is a performance logger, logging the elapsed time along with the message, status code, and other details.
 func (l Logger) Plog(message interface{}, elapsed time.Duration, moduleName string, statusCode string, statusMessage string) {
+	level := LOG
+	switch statusCode {
+	case "0", "1", "2", "3":
+	case "4":
+		level = WARN
+	default:
+		level = ERROR
+	}
+	if !l.Enabled(level, moduleName) {
+		return
+	}
+	// Structured formats write the elapsed time as a number of milliseconds, so that latencies can be queried.
+	fields := Fields{"duration_ms": float64(elapsed) / float64(time.Millisecond)}
+	if statusCode != "0" {
+		fields["status"] = statusMessage
+	}
+	if l.structured(level, message, moduleName, fields) {
+		return
+	}
+	message = l.textMessage(message)
 	var formattedMessage string
 	switch statusCode {
 	// Handling different status codes to format the message appropriately.
 	case "0":
 		formattedMessage = fmt.Sprintf("%s %s %s %s %s %s",
-			l.Color("blue")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("blue")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("blue")("LOG"),
 			l.Color("green")(fmt.Sprintf("[%s]", moduleName)),
@@ -100,28 +316,37 @@ func (l Logger) Plog(message interface{}, elapsed time.Duration, moduleName stri
 			l.Color("cyan")(fmt.Sprintf("+%.0f ms", elapsed.Seconds()*1000)))
 	case "2":
 		formattedMessage = fmt.Sprintf("%s %s %s %s",
-			l.Color("white")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("white")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("green")(fmt.Sprintf("LOG [%s] [\"%s\"] %s", moduleName, statusMessage, message)),
 			l.Color("cyan")(fmt.Sprintf("+%.0f ms", elapsed.Seconds()*1000)))
-	case "3":
+	case "1", "3":
 		formattedMessage = fmt.Sprintf("%s %s %s %s",
-			l.Color("white")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("white")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
 			l.Color("blue")(fmt.Sprintf("LOG [%s] [\"%s\"] %s", moduleName, statusMessage, message)),
 			l.Color("cyan")(fmt.Sprintf("+%.0f ms", elapsed.Seconds()*1000)))
+	case "4":
+		formattedMessage = fmt.Sprintf("%s %s %s %s",
+			l.Color("white")(l.prefix()),
+			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
+			l.Color("yellow")(fmt.Sprintf("WARN [%s] [\"%s\"] %s", moduleName, statusMessage, message)),
+			l.Color("cyan")(fmt.Sprintf("+%.0f ms", elapsed.Seconds()*1000)))
 	default:
 		// Default case: log with error status code.
 		formattedMessage = fmt.Sprintf("%s %s %s %s",
-			l.Color("white")("[Sprint] [Dev - v0.0.0]"),
+			l.Color("white")(l.prefix()),
 			l.Color("white")(time.Now().Format("| 02/01/2006 - 15:04:05 |")),
-			l.Color("red")(fmt.Sprintf("LOG [%s] [\"%s\"] %s", moduleName, statusMessage, message)),
+			l.Color("red")(fmt.Sprintf("ERROR [%s] [\"%s\"] %s", moduleName, statusMessage, message)),
 			l.Color("cyan")(fmt.Sprintf("+%.0f ms", elapsed.Seconds()*1000)))
 	}
-	fmt.Println(formattedMessage)
+	l.println(formattedMessage)
 }
 
 // Reload logs a server reloading message with a timestamp.
 func (l Logger) Reload() {
-	fmt.Printf(l.Color("white")(fmt.Sprintf("[Sprint] [Dev - v0.0.0] - [%s] - Server Reloading ...\n", time.Now().Format("02/01/2006, 15:04:05"))))
+	if !l.Enabled(LOG, "") || l.structured(LOG, "Server Reloading ...", "", nil) {
+		return
+	}
+	l.println(l.Color("white")(fmt.Sprintf("%s - [%s] - Server Reloading ...", l.prefix(), time.Now().Format("02/01/2006, 15:04:05"))))
 }
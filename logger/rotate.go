@@ -0,0 +1,285 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxFileSize is the size at which a RotatingFile is rotated when its MaxSize is zero.
+const DefaultMaxFileSize = 100 << 20
+
+// backupTimeFormat is the format of the time in the names of rotated files, sortable and valid in file names.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile is an io.WriteCloser appending to a file that is rotated by size and age, used as the Output
+// of a Logger, possibly through an AsyncWriter. A rotated file is renamed with the UTC time of the rotation,
+// e.g., "logs/app-2026-01-02T15-04-05.000.log", then compressed to "logs/app-2026-01-02T15-04-05.000.log.gz"
+// when Compress is set. Its zero value is not usable: Filename is required.
+type RotatingFile struct {
+	Filename   string        // Path of the current file, e.g., "logs/app.log". Missing directories are created.
+	MaxSize    int64         // Size in bytes above which the file is rotated, DefaultMaxFileSize when zero.
+	MaxAge     time.Duration // Time after which the file is rotated, counted from its creation, across restarts; no limit when zero.
+	MaxBackups int           // Number of rotated files kept, the oldest ones being removed; every file is kept when zero.
+	Compress   bool          // Compresses rotated files with gzip, in the background.
+
+	mutex       sync.Mutex
+	file        *os.File
+	size        int64
+	openedAt    time.Time
+	maintenance sync.Mutex     // Serializes the compression and removal of rotated files.
+	pending     sync.WaitGroup // Running maintenance goroutines, awaited by Close.
+}
+
+// Write appends p to the file, rotating it first when MaxAge has passed. When p exceeds MaxSize, its complete lines
+// are split across files, so that the batched writes of an AsyncWriter do not make files grow beyond MaxSize.
+func (file *RotatingFile) Write(p []byte) (int, error) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if file.file == nil {
+		if err := file.open(); err != nil {
+			return 0, err
+		}
+	}
+	if file.MaxAge > 0 && time.Since(file.openedAt) >= file.MaxAge {
+		if err := file.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	maxSize := file.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	written := 0
+	for file.size+int64(len(p)) > maxSize {
+		cut := -1
+		if room := maxSize - file.size; room > 0 {
+			cut = bytes.LastIndexByte(p[:min(room, int64(len(p)))], '\n')
+		}
+		if cut < 0 && file.size == 0 {
+			break // A line longer than MaxSize is written to its own file.
+		}
+		if cut >= 0 {
+			n, err := file.file.Write(p[:cut+1])
+			file.size += int64(n)
+			written += n
+			if err != nil {
+				return written, err
+			}
+			p = p[cut+1:]
+		}
+		if err := file.rotate(); err != nil {
+			return written, err
+		}
+	}
+	n, err := file.file.Write(p)
+	file.size += int64(n)
+	return written + n, err
+}
+
+// Rotate closes the current file, renames it and opens a new one, e.g., on SIGHUP.
+func (file *RotatingFile) Rotate() error {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if file.file == nil {
+		if err := file.open(); err != nil {
+			return err
+		}
+	}
+	return file.rotate()
+}
+
+// Sync commits the content of the file to stable storage.
+func (file *RotatingFile) Sync() error {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if file.file == nil {
+		return nil
+	}
+	return file.file.Sync()
+}
+
+// Close closes the file and waits for the rotated files to be compressed.
+func (file *RotatingFile) Close() error {
+	file.mutex.Lock()
+	var err error
+	if file.file != nil {
+		err = file.file.Close()
+		file.file = nil
+	}
+	file.mutex.Unlock()
+	file.pending.Wait()
+	return err
+}
+
+// open opens the current file for appending, creating it and its directory if needed.
+func (file *RotatingFile) open() error {
+	if file.Filename == "" {
+		return errors.New("logger: RotatingFile without Filename")
+	}
+	if err := os.MkdirAll(filepath.Dir(file.Filename), 0o755); err != nil {
+		return err
+	}
+	opened, err := os.OpenFile(file.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := opened.Stat()
+	if err != nil {
+		opened.Close()
+		return err
+	}
+	file.file, file.size, file.openedAt = opened, info.Size(), time.Now()
+	if info.Size() > 0 {
+		file.openedAt = file.createdAt(info)
+	}
+	return nil
+}
+
+// createdAt returns the time an existing file was started at, so that its age does not start over when the
+// process restarts: the time of the rotation which created it, or its modification time when it was never rotated.
+func (file *RotatingFile) createdAt(info os.FileInfo) time.Time {
+	backups, err := file.backups()
+	if err != nil || len(backups) == 0 {
+		return info.ModTime()
+	}
+	rotatedAt, _ := file.backupTime(filepath.Base(backups[len(backups)-1]))
+	return rotatedAt
+}
+
+// rotate renames the current file, opens a new one and starts the maintenance of the rotated files.
+func (file *RotatingFile) rotate() error {
+	if err := file.file.Close(); err != nil {
+		return err
+	}
+	file.file = nil
+	rotatedAt := time.Now().UTC()
+	backup := file.backupName(rotatedAt)
+	for exists(backup) || exists(backup+".gz") {
+		// Rotations within the same millisecond get distinct names.
+		rotatedAt = rotatedAt.Add(time.Millisecond)
+		backup = file.backupName(rotatedAt)
+	}
+	if err := os.Rename(file.Filename, backup); err != nil {
+		return err
+	}
+	if err := file.open(); err != nil {
+		return err
+	}
+	file.pending.Add(1)
+	go func() {
+		defer file.pending.Done()
+		file.maintain()
+	}()
+	return nil
+}
+
+// backupName returns the name of a file rotated at the given time.
+func (file *RotatingFile) backupName(rotatedAt time.Time) string {
+	extension := filepath.Ext(file.Filename)
+	return strings.TrimSuffix(file.Filename, extension) + "-" + rotatedAt.Format(backupTimeFormat) + extension
+}
+
+// maintain compresses the rotated files when Compress is set, then removes the rotated files beyond MaxBackups.
+// Failures are reported on os.Stderr, since the log itself may be unusable.
+func (file *RotatingFile) maintain() {
+	file.maintenance.Lock()
+	defer file.maintenance.Unlock()
+	backups, err := file.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: listing the rotated files of %s: %v\n", file.Filename, err)
+		return
+	}
+	if file.MaxBackups > 0 && len(backups) > file.MaxBackups {
+		for _, backup := range backups[:len(backups)-file.MaxBackups] {
+			if err := os.Remove(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: removing %s: %v\n", backup, err)
+			}
+		}
+		backups = backups[len(backups)-file.MaxBackups:]
+	}
+	if !file.Compress {
+		return
+	}
+	for _, backup := range backups {
+		if strings.HasSuffix(backup, ".gz") {
+			continue
+		}
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: compressing %s: %v\n", backup, err)
+		}
+	}
+}
+
+// backups returns the paths of the rotated files, from the oldest to the newest.
+func (file *RotatingFile) backups() ([]string, error) {
+	extension := filepath.Ext(file.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(file.Filename), extension) + "-"
+	entries, err := os.ReadDir(filepath.Dir(file.Filename))
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := file.backupTime(name); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(file.Filename), name))
+	}
+	// The times in the names sort chronologically.
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// backupTime returns the time of the rotation of a rotated file, from its name.
+func (file *RotatingFile) backupTime(name string) (time.Time, error) {
+	extension := filepath.Ext(file.Filename)
+	prefix := strings.TrimSuffix(filepath.Base(file.Filename), extension) + "-"
+	timestamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), extension)
+	return time.Parse(backupTimeFormat, strings.TrimPrefix(timestamp, prefix))
+}
+
+// exists reports whether a file exists at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// compressFile replaces a file by its gzip-compressed version, with the ".gz" extension.
+func compressFile(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(destination)
+	_, err = io.Copy(writer, source)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	source.Close()
+	return os.Remove(path)
+}
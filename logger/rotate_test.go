@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFile returns the content of a file, decompressed when its name ends with ".gz".
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		if reader, err = gzip.NewReader(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// writeLines writes each line to the file, failing the test on errors.
+func writeLines(t *testing.T, file *RotatingFile, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		file := &RotatingFile{Filename: filepath.Join(t.TempDir(), "logs", "app.log"), MaxSize: 10, MaxBackups: 2, Compress: compress}
+		writeLines(t, file, "one\n", "two\n", "three\n", "four\n", "five\n")
+		// Lines are never split, and a batch larger than the room left is split on its lines.
+		writeLines(t, file, "six\nseven\n", "eight\nnine\n")
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		backups, err := file.backups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var contents []string
+		for _, backup := range backups {
+			if strings.HasSuffix(backup, ".gz") != compress {
+				t.Errorf("compress=%v: rotated file %s", compress, backup)
+			}
+			contents = append(contents, readFile(t, backup))
+		}
+		contents = append(contents, readFile(t, file.Filename))
+		if got, want := strings.Join(contents, "|"), "six\nseven\n|eight\n|nine\n"; got != want {
+			t.Errorf("compress=%v: files are %q, want %q", compress, got, want)
+		}
+	}
+}
+
+func TestRotatingFileMaxAgeAcrossRestarts(t *testing.T) {
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "app.log")
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+
+	// A file that was never rotated is as old as its last modification.
+	if err := os.WriteFile(filename, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filename, twoHoursAgo, twoHoursAgo); err != nil {
+		t.Fatal(err)
+	}
+	file := &RotatingFile{Filename: filename, MaxAge: time.Hour}
+	writeLines(t, file, "new\n")
+	file.Close()
+	if backups, _ := file.backups(); len(backups) != 1 || readFile(t, filename) != "new\n" {
+		t.Fatalf("the file older than MaxAge was not rotated: backups %v", backups)
+	}
+
+	// A rotated file is as old as its rotation, whatever its last modification.
+	backups, _ := file.backups()
+	if err := os.Rename(backups[0], file.backupName(twoHoursAgo.UTC())); err != nil {
+		t.Fatal(err)
+	}
+	file = &RotatingFile{Filename: filename, MaxAge: time.Hour}
+	writeLines(t, file, "newer\n")
+	file.Close()
+	if backups, _ := file.backups(); len(backups) != 2 || readFile(t, filename) != "newer\n" {
+		t.Fatalf("the file created by a rotation older than MaxAge was not rotated: backups %v", backups)
+	}
+
+	// A file younger than MaxAge is appended to.
+	file = &RotatingFile{Filename: filename, MaxAge: time.Hour}
+	writeLines(t, file, "newest\n")
+	file.Close()
+	if backups, _ := file.backups(); len(backups) != 2 || readFile(t, filename) != "newer\nnewest\n" {
+		t.Errorf("the file younger than MaxAge was rotated: backups %v", backups)
+	}
+}
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// DefaultSlogModule is the module name of slog records without a "module" attribute.
+const DefaultSlogModule = "App"
+
+// SlogLevel returns the slog level corresponding to the level.
+func (level Level) SlogLevel() slog.Level {
+	switch {
+	case level <= DEBUG:
+		return slog.LevelDebug
+	case level == LOG:
+		return slog.LevelInfo
+	case level == WARN:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// levelFromSlog returns the level corresponding to a slog level.
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return LOG
+	case level < slog.LevelError:
+		return WARN
+	}
+	return ERROR
+}
+
+// handle sends a message to the slog handler of the logger, with the module name and the fields as attributes.
+func (l Logger) handle(level Level, message interface{}, moduleName string, fields Fields) {
+	ctx := context.Background()
+	if !l.Handler.Enabled(ctx, level.SlogLevel()) {
+		return
+	}
+	record := slog.NewRecord(time.Now(), level.SlogLevel(), fmt.Sprint(message), 0)
+	record.AddAttrs(slog.String(ModuleKey, moduleName))
+	for _, key := range fields.sortedKeys() {
+		record.AddAttrs(slog.Any(key, fields[key]))
+	}
+	l.Handler.Handle(ctx, record)
+}
+
+// SlogHandler is a slog.Handler writing records through a logger.Interface, so that slog.Logger can be used
+// with the Sprint output. The "module" attribute of a record is used as its module name.
+type SlogHandler struct {
+	logger Interface
+	fields Fields
+	group  string // Prefix of the keys of the next attributes, e.g., "request.".
+}
+
+// NewSlogHandler returns a slog.Handler writing records through the logger, e.g., slog.New(logger.NewSlogHandler(logger.Logger{Format: logger.JSON})).
+func NewSlogHandler(logger Interface) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// Enabled reports whether records of the level are logged. The level of the module given by WithAttrs is used
+// for Logger and *Logger, other implementations of Interface filter the records themselves.
+func (handler *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if l, ok := handler.logger.(FieldLogger); ok {
+		return l.Enabled(levelFromSlog(level), handler.moduleName(nil))
+	}
+	return true
+}
+
+// Handle logs the record.
+func (handler *SlogHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make(Fields, len(handler.fields)+record.NumAttrs())
+	for key, value := range handler.fields {
+		fields[key] = value
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(fields, handler.group, attr)
+		return true
+	})
+	moduleName := handler.moduleName(fields)
+	delete(fields, ModuleKey)
+	level := levelFromSlog(record.Level)
+
+	if l, ok := handler.logger.(FieldLogger); ok {
+		l.LogFields(level, record.Message, moduleName, fields)
+		return nil
+	}
+	// Other implementations only receive a message, followed by the fields as logfmt pairs.
+	var builder strings.Builder
+	builder.WriteString(record.Message)
+	writeLogfmtFields(&builder, fields)
+	switch level {
+	case DEBUG:
+		handler.logger.Debug(builder.String(), moduleName)
+	case LOG:
+		handler.logger.Log(builder.String(), moduleName)
+	case WARN:
+		handler.logger.Warn(builder.String(), moduleName)
+	default:
+		handler.logger.Error(builder.String(), moduleName)
+	}
+	return nil
+}
+
+// WithAttrs returns a handler adding the attributes to every record.
+func (handler *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(Fields, len(handler.fields)+len(attrs))
+	for key, value := range handler.fields {
+		fields[key] = value
+	}
+	for _, attr := range attrs {
+		addAttr(fields, handler.group, attr)
+	}
+	return &SlogHandler{logger: handler.logger, fields: fields, group: handler.group}
+}
+
+// WithGroup returns a handler prefixing the keys of the next attributes with the group name and a dot.
+func (handler *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return handler
+	}
+	return &SlogHandler{logger: handler.logger, fields: handler.fields, group: handler.group + name + "."}
+}
+
+// moduleName returns the value of the "module" field, from fields or from the attributes of the handler.
+func (handler *SlogHandler) moduleName(fields Fields) string {
+	if moduleName, ok := fields[ModuleKey].(string); ok {
+		return moduleName
+	}
+	if moduleName, ok := handler.fields[ModuleKey].(string); ok {
+		return moduleName
+	}
+	return DefaultSlogModule
+}
+
+// addAttr adds a resolved attribute to the fields, flattening groups into dotted keys.
+func addAttr(fields Fields, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range value.Group() {
+			addAttr(fields, prefix, groupAttr)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
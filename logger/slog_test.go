@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	// The logger given to the handler can be a Logger or a *Logger.
+	for _, pointer := range []bool{false, true} {
+		var output bytes.Buffer
+		var l Interface = Logger{Output: &output, Format: LOGFMT, Modules: map[string]Level{"Quiet": WARN}}
+		if pointer {
+			l = &Logger{Output: &output, Format: LOGFMT, Modules: map[string]Level{"Quiet": WARN}}
+		}
+		quiet := slog.New(NewSlogHandler(l)).With(ModuleKey, "Quiet")
+
+		quiet.Info("skipped")
+		quiet.Warn("kept", "user", 42)
+		if got := output.String(); strings.Contains(got, "skipped") || !strings.Contains(got, "msg=kept") || !strings.Contains(got, "user=42") || !strings.Contains(got, "module=Quiet") {
+			t.Errorf("pointer=%v: output is %q, want only the WARN record with its fields", pointer, got)
+		}
+	}
+}
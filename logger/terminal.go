@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+)
+
+// ColorMode tells when the TEXT format is colored.
+type ColorMode int
+
+// Enumeration of ColorMode.
+const (
+	ColorAuto   ColorMode = iota // Colors are used when the output is a terminal, NO_COLOR is not set and TERM is not "dumb".
+	ColorAlways                  // Colors are always used, e.g., for CI logs rendering ANSI colors.
+	ColorNever                   // Colors are never used.
+)
+
+// colored reports whether the messages written to the output are colored.
+func (l Logger) colored() bool {
+	switch l.ColorMode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(l.output())
+}
+
+// terminals caches whether file descriptors refer to a terminal, so that the check is not done for every message.
+var terminals sync.Map
+
+// isTerminal reports whether the writer is a file referring to a terminal.
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+	fd := file.Fd()
+	if terminal, ok := terminals.Load(fd); ok {
+		return terminal.(bool)
+	}
+	terminal := isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+	terminals.Store(fd, terminal)
+	return terminal
+}
+
+// sprintModule is the path of the Sprint module, whose version is printed when no application name is set.
+const sprintModule = "github.com/zlorgoncho1/sprint"
+
+var (
+	versionsOnce     sync.Once
+	mainVersion      string // Version of the main module.
+	frameworkVersion string // Version of the Sprint module.
+)
+
+// versions reads the versions of the main and Sprint modules from the build info of the binary.
+// Modules built from a working tree have the version "(devel)".
+func versions() (string, string) {
+	versionsOnce.Do(func() {
+		mainVersion, frameworkVersion = "(devel)", "(devel)"
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if info.Main.Version != "" {
+			mainVersion = info.Main.Version
+		}
+		if info.Main.Path == sprintModule {
+			frameworkVersion = mainVersion
+		}
+		for _, module := range info.Deps {
+			if module.Path == sprintModule && module.Version != "" {
+				frameworkVersion = module.Version
+				if module.Replace != nil && module.Replace.Version != "" {
+					frameworkVersion = module.Replace.Version
+				}
+			}
+		}
+	})
+	return mainVersion, frameworkVersion
+}
+
+// DefaultEnv is the environment printed in the prefix of the TEXT format when Logger.Env is empty.
+const DefaultEnv = "dev"
+
+// prefix returns the prefix of the messages in the TEXT format, e.g., "[Sprint] [dev - v1.2.0]".
+// It shows the name and version of the application when AppName is set, of Sprint otherwise.
+func (l Logger) prefix() string {
+	appName, version := l.AppName, l.Version
+	mainVersion, frameworkVersion := versions()
+	if appName == "" {
+		appName = "Sprint"
+		if version == "" {
+			version = frameworkVersion
+		}
+	} else if version == "" {
+		version = mainVersion
+	}
+	env := l.Env
+	if env == "" {
+		env = DefaultEnv
+	}
+	return "[" + appName + "] [" + env + " - " + version + "]"
+}
+
+// output returns the destination of the messages.
+func (l Logger) output() io.Writer {
+	if l.Output == nil {
+		return os.Stdout
+	}
+	return l.Output
+}
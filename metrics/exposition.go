@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType core.ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteTo writes every metric in the Prometheus text exposition format, sorted by name and label values.
+func (registry *Registry) WriteTo(w io.Writer) (int64, error) {
+	registry.mutex.Lock()
+	families := make([]*family, 0, len(registry.families))
+	for _, family := range registry.families {
+		families = append(families, family)
+	}
+	registry.mutex.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	counter := &countingWriter{writer: w}
+	buffer := bufio.NewWriter(counter)
+	for _, family := range families {
+		family.write(buffer)
+	}
+	err := buffer.Flush()
+	return counter.written, err
+}
+
+// write writes the HELP and TYPE lines of the family, then its series.
+func (family *family) write(buffer *bufio.Writer) {
+	family.mutex.RLock()
+	allSeries := make([]*series, 0, len(family.series))
+	for _, series := range family.series {
+		allSeries = append(allSeries, series)
+	}
+	family.mutex.RUnlock()
+	sort.Slice(allSeries, func(i, j int) bool {
+		return strings.Join(allSeries[i].labelValues, "\xff") < strings.Join(allSeries[j].labelValues, "\xff")
+	})
+
+	if family.help != "" {
+		buffer.WriteString("# HELP " + family.name + " " + escapeHelp(family.help) + "\n")
+	}
+	buffer.WriteString("# TYPE " + family.name + " " + family.kind + "\n")
+	for _, series := range allSeries {
+		labels := family.labels(series.labelValues)
+		if family.kind != "histogram" {
+			buffer.WriteString(family.name + formatLabels(labels) + " " + formatValue(series.value()) + "\n")
+			continue
+		}
+		series.mutex.Lock()
+		counts, sum := append([]uint64(nil), series.counts...), series.sum
+		series.mutex.Unlock()
+		var cumulative uint64
+		for index, count := range counts {
+			cumulative += count
+			bound := math.Inf(1)
+			if index < len(family.buckets) {
+				bound = family.buckets[index]
+			}
+			bucketLabels := append(append([][2]string(nil), labels...), [2]string{"le", formatValue(bound)})
+			buffer.WriteString(family.name + "_bucket" + formatLabels(bucketLabels) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		buffer.WriteString(family.name + "_sum" + formatLabels(labels) + " " + formatValue(sum) + "\n")
+		buffer.WriteString(family.name + "_count" + formatLabels(labels) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+	}
+}
+
+// labels pairs the label names of the family with the values of a series.
+func (family *family) labels(values []string) [][2]string {
+	labels := make([][2]string, len(values))
+	for index, value := range values {
+		labels[index] = [2]string{family.labelNames[index], value}
+	}
+	return labels
+}
+
+// formatLabels formats labels as {name="value",...}, or returns an empty string when there are none.
+func formatLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for index, label := range labels {
+		if index > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(label[0] + `="` + escapeLabelValue(label[1]) + `"`)
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+// formatValue formats a sample value, with the +Inf, -Inf and NaN spellings of the format.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and line feeds in a HELP line.
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// escapeLabelValue escapes backslashes, line feeds and double quotes in a label value.
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// countingWriter counts the bytes written to a writer.
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+// Write writes p and counts the bytes written.
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	n, err := writer.writer.Write(p)
+	writer.written += int64(n)
+	return n, err
+}
+
+// Handler returns a route handler serving the metrics of the registry in the Prometheus text format.
+func Handler(registry *Registry) func(request core.Request) core.Response {
+	return func(request core.Request) core.Response {
+		var body strings.Builder
+		registry.WriteTo(&body)
+		return core.Response{Content: body.String(), ContentType: ContentType}
+	}
+}
+
+// Controller returns a controller serving the metrics of the registry with GET on the given path, e.g., "metrics".
+func Controller(path string, registry *Registry) *core.Controller {
+	controller := &core.Controller{Name: "Metrics", Path: path}
+	controller.AddRoute(core.GET, "", Handler(registry))
+	return controller
+}
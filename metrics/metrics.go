@@ -0,0 +1,235 @@
+// Package metrics collects counters, gauges and histograms and exposes them in the Prometheus text format,
+// without an external client library. The server records its own metrics in Server.Metrics:
+//
+//	registry := metrics.NewRegistry()
+//	orders := registry.NewCounter("shop_orders_total", "Orders placed.", "country")
+//	orders.Inc("SN")
+//
+//	srv := &server.Server{Metrics: registry}
+//	srv.Start(&core.Module{Controllers: []*core.Controller{metrics.Controller("metrics", registry)}})
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the upper bounds of histograms measuring durations in seconds, from 5 ms to 10 s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegexp  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Registry holds metrics, identified by their names.
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// DefaultRegistry is a Registry shared by the application, e.g., by packages defining their metrics at init.
+var DefaultRegistry = NewRegistry()
+
+// family is a metric with all its series, one per combination of label values.
+type family struct {
+	name       string
+	help       string
+	kind       string // Prometheus type: "counter", "gauge" or "histogram".
+	labelNames []string
+	buckets    []float64 // Sorted upper bounds of histograms, without +Inf.
+
+	mutex  sync.RWMutex
+	series map[string]*series // Keyed by the joined label values.
+}
+
+// series holds the value of a metric for a combination of label values.
+type series struct {
+	labelValues []string
+	bits        atomic.Uint64 // Value of counters and gauges, as the bits of a float64.
+
+	mutex  sync.Mutex // Guards the fields of histograms.
+	counts []uint64   // Observations per bucket, not cumulative; the last one counts the values above every bound.
+	sum    float64
+}
+
+// add adds delta to the value of a counter or gauge.
+func (series *series) add(delta float64) {
+	for {
+		old := series.bits.Load()
+		if series.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// value returns the value of a counter or gauge.
+func (series *series) value() float64 {
+	return math.Float64frombits(series.bits.Load())
+}
+
+// register returns the family with the given name, creating it when it does not exist.
+// It panics if the name or a label name is invalid, or if the name is used by a different metric.
+func (registry *Registry) register(name, help, kind string, buckets []float64, labelNames []string) *family {
+	if !metricNameRegexp.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, labelName := range labelNames {
+		if !labelNameRegexp.MatchString(labelName) || strings.HasPrefix(labelName, "__") || (kind == "histogram" && labelName == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name %q of %s", labelName, name))
+		}
+	}
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if existing, ok := registry.families[name]; ok {
+		// Registering the same metric again returns it, e.g., for several servers sharing a registry.
+		if existing.kind != kind || strings.Join(existing.labelNames, ",") != strings.Join(labelNames, ",") || fmt.Sprint(existing.buckets) != fmt.Sprint(buckets) {
+			panic(fmt.Sprintf("metrics: %s is already registered with a different type, labels or buckets", name))
+		}
+		return existing
+	}
+	family := &family{name: name, help: help, kind: kind, labelNames: labelNames, buckets: buckets, series: make(map[string]*series)}
+	if len(labelNames) == 0 {
+		family.with(nil) // Metrics without labels are exposed from the start, with a zero value.
+	}
+	registry.families[name] = family
+	return family
+}
+
+// with returns the series of the label values, creating it on first use. It panics if the number of values
+// does not match the label names of the metric.
+func (family *family) with(labelValues []string) *series {
+	if len(labelValues) != len(family.labelNames) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", family.name, len(family.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	family.mutex.RLock()
+	existing, ok := family.series[key]
+	family.mutex.RUnlock()
+	if ok {
+		return existing
+	}
+	family.mutex.Lock()
+	defer family.mutex.Unlock()
+	if existing, ok := family.series[key]; ok {
+		return existing
+	}
+	created := &series{labelValues: append([]string(nil), labelValues...)}
+	if family.kind == "histogram" {
+		created.counts = make([]uint64, len(family.buckets)+1)
+	}
+	family.series[key] = created
+	return created
+}
+
+// value returns the value of the series of the label values, zero when it does not exist.
+func (family *family) value(labelValues []string) float64 {
+	family.mutex.RLock()
+	defer family.mutex.RUnlock()
+	if existing, ok := family.series[strings.Join(labelValues, "\xff")]; ok {
+		return existing.value()
+	}
+	return 0
+}
+
+// Counter is a value that only increases, e.g., a number of requests.
+type Counter struct {
+	family *family
+}
+
+// NewCounter registers a counter with the given label names, or returns the counter already registered with the name.
+func (registry *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{family: registry.register(name, help, "counter", nil, labelNames)}
+}
+
+// Inc adds one to the counter of the label values.
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter of the label values.
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	counter.family.with(labelValues).add(value)
+}
+
+// Value returns the value of the counter of the label values.
+func (counter *Counter) Value(labelValues ...string) float64 {
+	return counter.family.value(labelValues)
+}
+
+// Gauge is a value that goes up and down, e.g., a number of open connections.
+type Gauge struct {
+	family *family
+}
+
+// NewGauge registers a gauge with the given label names, or returns the gauge already registered with the name.
+func (registry *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{family: registry.register(name, help, "gauge", nil, labelNames)}
+}
+
+// Set sets the gauge of the label values.
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.family.with(labelValues).bits.Store(math.Float64bits(value))
+}
+
+// Inc adds one to the gauge of the label values.
+func (gauge *Gauge) Inc(labelValues ...string) {
+	gauge.Add(1, labelValues...)
+}
+
+// Dec subtracts one from the gauge of the label values.
+func (gauge *Gauge) Dec(labelValues ...string) {
+	gauge.Add(-1, labelValues...)
+}
+
+// Add adds a value, possibly negative, to the gauge of the label values.
+func (gauge *Gauge) Add(value float64, labelValues ...string) {
+	gauge.family.with(labelValues).add(value)
+}
+
+// Value returns the value of the gauge of the label values.
+func (gauge *Gauge) Value(labelValues ...string) float64 {
+	return gauge.family.value(labelValues)
+}
+
+// Histogram counts observations, e.g., request durations, in buckets.
+type Histogram struct {
+	family *family
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds, DefaultBuckets when nil, and label names,
+// or returns the histogram already registered with the name.
+func (registry *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	if len(buckets) > 0 && math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1] // The +Inf bucket is always written.
+	}
+	return &Histogram{family: registry.register(name, help, "histogram", buckets, labelNames)}
+}
+
+// Observe adds a value to the histogram of the label values.
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	series := histogram.family.with(labelValues)
+	index := sort.SearchFloat64s(histogram.family.buckets, value)
+	series.mutex.Lock()
+	series.counts[index]++
+	series.sum += value
+	series.mutex.Unlock()
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(registry *Registry)
+		want   string
+	}{
+		{
+			"counter without labels",
+			func(registry *Registry) { registry.NewCounter("jobs_total", "Jobs run.") },
+			"# HELP jobs_total Jobs run.\n" +
+				"# TYPE jobs_total counter\n" +
+				"jobs_total 0\n",
+		},
+		{
+			"counter with labels, sorted by values",
+			func(registry *Registry) {
+				orders := registry.NewCounter("orders_total", "Orders placed.", "country", "channel")
+				orders.Inc("SN", "web")
+				orders.Add(2.5, "FR", "app")
+				orders.Inc("SN", "web")
+			},
+			"# HELP orders_total Orders placed.\n" +
+				"# TYPE orders_total counter\n" +
+				`orders_total{country="FR",channel="app"} 2.5` + "\n" +
+				`orders_total{country="SN",channel="web"} 2` + "\n",
+		},
+		{
+			"escaped help and label values",
+			func(registry *Registry) {
+				registry.NewGauge("paths", "Paths\nwith a \\ and \"quotes\".", "path").Set(1, "C:\\tmp\n\"x\"")
+			},
+			`# HELP paths Paths\nwith a \\ and "quotes".` + "\n" +
+				"# TYPE paths gauge\n" +
+				`paths{path="C:\\tmp\n\"x\""} 1` + "\n",
+		},
+		{
+			"gauge with special values, without help",
+			func(registry *Registry) {
+				temperature := registry.NewGauge("temperature", "", "sensor")
+				temperature.Set(math.Inf(1), "a")
+				temperature.Set(math.Inf(-1), "b")
+				temperature.Set(math.NaN(), "c")
+				temperature.Set(1e-7, "d")
+				temperature.Inc("e")
+				temperature.Dec("e")
+				temperature.Dec("e")
+			},
+			"# TYPE temperature gauge\n" +
+				`temperature{sensor="a"} +Inf` + "\n" +
+				`temperature{sensor="b"} -Inf` + "\n" +
+				`temperature{sensor="c"} NaN` + "\n" +
+				`temperature{sensor="d"} 1e-07` + "\n" +
+				`temperature{sensor="e"} -1` + "\n",
+		},
+		{
+			"histogram with cumulative buckets",
+			func(registry *Registry) {
+				latency := registry.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1, math.Inf(1)}, "route")
+				for _, value := range []float64{0.05, 0.1, 0.5, 2} {
+					latency.Observe(value, "/users")
+				}
+			},
+			"# HELP latency_seconds Latency.\n" +
+				"# TYPE latency_seconds histogram\n" +
+				`latency_seconds_bucket{route="/users",le="0.1"} 2` + "\n" +
+				`latency_seconds_bucket{route="/users",le="1"} 3` + "\n" +
+				`latency_seconds_bucket{route="/users",le="+Inf"} 4` + "\n" +
+				`latency_seconds_sum{route="/users"} 2.65` + "\n" +
+				`latency_seconds_count{route="/users"} 4` + "\n",
+		},
+		{
+			"histogram without labels nor observations",
+			func(registry *Registry) { registry.NewHistogram("size_bytes", "Sizes.", []float64{10}) },
+			"# HELP size_bytes Sizes.\n" +
+				"# TYPE size_bytes histogram\n" +
+				`size_bytes_bucket{le="10"} 0` + "\n" +
+				`size_bytes_bucket{le="+Inf"} 0` + "\n" +
+				"size_bytes_sum 0\n" +
+				"size_bytes_count 0\n",
+		},
+		{
+			"families sorted by name",
+			func(registry *Registry) {
+				registry.NewGauge("b", "")
+				registry.NewGauge("a", "")
+			},
+			"# TYPE a gauge\na 0\n# TYPE b gauge\nb 0\n",
+		},
+	}
+	for _, test := range tests {
+		registry := NewRegistry()
+		test.record(registry)
+		var output strings.Builder
+		written, err := registry.WriteTo(&output)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if output.String() != test.want {
+			t.Errorf("%s: output is\n%s\nwant\n%s", test.name, output.String(), test.want)
+		}
+		if written != int64(output.Len()) {
+			t.Errorf("%s: WriteTo returned %d bytes, wrote %d", test.name, written, output.Len())
+		}
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(registry *Registry)
+	}{
+		{"invalid metric name", func(registry *Registry) { registry.NewCounter("requests-total", "") }},
+		{"invalid label name", func(registry *Registry) { registry.NewCounter("requests_total", "", "status code") }},
+		{"reserved label name", func(registry *Registry) { registry.NewCounter("requests_total", "", "__name") }},
+		{"le label of a histogram", func(registry *Registry) { registry.NewHistogram("latency", "", nil, "le") }},
+		{"different type", func(registry *Registry) {
+			registry.NewCounter("requests_total", "")
+			registry.NewGauge("requests_total", "")
+		}},
+		{"different labels", func(registry *Registry) {
+			registry.NewCounter("requests_total", "", "method")
+			registry.NewCounter("requests_total", "", "route")
+		}},
+		{"wrong number of label values", func(registry *Registry) { registry.NewCounter("requests_total", "", "method").Inc() }},
+		{"negative counter increment", func(registry *Registry) { registry.NewCounter("requests_total", "").Add(-1) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", test.name)
+				}
+			}()
+			test.register(NewRegistry())
+		}()
+	}
+
+	registry := NewRegistry()
+	first := registry.NewCounter("requests_total", "", "method")
+	first.Inc("GET")
+	if second := registry.NewCounter("requests_total", "", "method"); second.Value("GET") != 1 {
+		t.Error("registering a metric again does not return the registered one")
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// http2Preface is the connection preface sent first by HTTP/2 clients (RFC 9113, section 3.4).
+const http2Preface = http2.ClientPreface
+
+// bufferedConn is a connection whose first bytes were already read into a bufio.Reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffer first, then from the connection.
+func (conn *bufferedConn) Read(p []byte) (int, error) {
+	return conn.reader.Read(p)
+}
+
+// http2Server returns the HTTP/2 server shared by every connection, creating it on first use.
+// Its http.Server is never listening: it holds the configuration of the connections and
+// sends GOAWAY to them on Shutdown.
+func (server *Server) http2Server() (*http2.Server, *http.Server) {
+	server.http2Once.Do(func() {
+		server.h2 = &http2.Server{MaxConcurrentStreams: server.MaxConcurrentStreams}
+		server.h1 = &http.Server{
+			Handler:           http.HandlerFunc(server.serveHTTP),
+			ReadHeaderTimeout: server.ReadHeaderTimeout,
+			ReadTimeout:       server.ReadTimeout,
+			WriteTimeout:      server.WriteTimeout,
+			IdleTimeout:       server.IdleTimeout,
+			MaxHeaderBytes:    server.maxHeaderBytes(),
+		}
+		if err := http2.ConfigureServer(server.h1, server.h2); err != nil {
+			server.logger().Error(fmt.Sprintf("Error configuring HTTP/2: %s", err), "ServerCore")
+		}
+	})
+	return server.h2, server.h1
+}
+
+// serveHTTP2 serves an HTTP/2 connection until it is closed. Streams are multiplexed, flow-controlled
+// and their headers HPACK-decoded by golang.org/x/net/http2; each stream is handled by serveHTTP.
+// upgrade and settings are set for connections upgraded from HTTP/1.1 with "Upgrade: h2c".
+func (server *Server) serveHTTP2(conn net.Conn, upgrade *http.Request, settings []byte) {
+	h2, h1 := server.http2Server()
+	// The deadlines of HTTP/1 requests do not apply: HTTP/2 connections manage their own timeouts.
+	conn.SetDeadline(time.Time{})
+	h2.ServeConn(conn, &http2.ServeConnOpts{
+		Context:        server.rootContext(),
+		BaseConfig:     h1,
+		Handler:        h1.Handler,
+		UpgradeRequest: upgrade,
+		Settings:       settings,
+	})
+}
+
+// negotiatedHTTP2 completes the TLS handshake of the connection and reports whether the client
+// selected HTTP/2 with ALPN.
+func (server *Server) negotiatedHTTP2(conn net.Conn) (bool, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok || server.DisableHTTP2 {
+		return false, nil
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return false, err
+	}
+	return tlsConn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS, nil
+}
+
+// hasHTTP2Preface reports whether a cleartext connection starts with the HTTP/2 preface (h2c with prior knowledge).
+func (server *Server) hasHTTP2Preface(conn net.Conn, reader *bufio.Reader) bool {
+	if !server.H2C || server.DisableHTTP2 {
+		return false
+	}
+	if _, isTLS := conn.(*tls.Conn); isTLS {
+		return false
+	}
+	// Peek the method first, so that short HTTP/1 requests never wait for 24 bytes.
+	if start, err := reader.Peek(3); err != nil || string(start) != http2Preface[:3] {
+		return false
+	}
+	preface, err := reader.Peek(len(http2Preface))
+	return err == nil && string(preface) == http2Preface
+}
+
+// upgradeH2C switches a cleartext HTTP/1.1 connection to HTTP/2 when the request carries
+// "Upgrade: h2c" and an HTTP2-Settings header (RFC 7540, section 3.2). The request is answered
+// on stream 1 of the new connection. It reports whether the connection was upgraded.
+func (server *Server) upgradeH2C(conn net.Conn, reader *bufio.Reader, message string) bool {
+	if !server.H2C || server.DisableHTTP2 {
+		return false
+	}
+	if _, isTLS := conn.(*tls.Conn); isTLS {
+		return false
+	}
+	upgrade, err := http.ReadRequest(bufio.NewReader(strings.NewReader(message)))
+	if err != nil || !headerHasToken(upgrade.Header, "Upgrade", "h2c") || !headerHasToken(upgrade.Header, "Connection", "HTTP2-Settings") {
+		return false
+	}
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(upgrade.Header.Get("HTTP2-Settings"), "="))
+	if err != nil || len(upgrade.Header.Values("HTTP2-Settings")) != 1 {
+		return false
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")); err != nil {
+		return true
+	}
+	upgrade.RemoteAddr = conn.RemoteAddr().String()
+	upgrade.Proto, upgrade.ProtoMajor, upgrade.ProtoMinor = "HTTP/2.0", 2, 0
+	upgrade = upgrade.WithContext(server.rootContext())
+	server.serveHTTP2(&bufferedConn{Conn: conn, reader: reader}, upgrade, settings)
+	return true
+}
+
+// headerHasToken reports whether a comma-separated header contains the token, case-insensitively.
+func headerHasToken(header http.Header, key, token string) bool {
+	for _, line := range header.Values(key) {
+		for _, value := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(value), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+	"golang.org/x/net/http2"
+)
+
+// selfSignedCertificate returns a certificate for 127.0.0.1 and the pool trusting it.
+func selfSignedCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sprint test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// http2TestModule returns a module echoing request bodies on POST /h2/echo and streaming two chunks
+// on GET /h2/stream, the second one once proceed is closed.
+func http2TestModule(proceed <-chan struct{}) *core.Module {
+	controller := &core.Controller{Name: "HTTP2", Path: "h2"}
+	controller.AddRoute(core.POST, "echo", func(request core.Request) core.Response {
+		return core.Response{Content: request.Protocol + " " + string(request.RawBody), ContentType: core.PLAINTEXT}
+	})
+	controller.AddRoute(core.GET, "stream", func(request core.Request) core.Response {
+		return core.Response{ContentType: core.PLAINTEXT, Stream: func(writer core.StreamWriter) error {
+			writer.Write([]byte("first\n"))
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			select {
+			case <-proceed:
+			case <-request.Context().Done():
+				return request.Context().Err()
+			}
+			_, err := writer.Write([]byte("second\n"))
+			return err
+		}}
+	})
+	return &core.Module{Name: "HTTP2Module", Controllers: []*core.Controller{controller}}
+}
+
+// startHTTP2TestServer serves the module on a local port, over TLS when tlsConfig is set, and returns its address.
+func startHTTP2TestServer(t *testing.T, server *Server, module *core.Module, tlsConfig *tls.Config) string {
+	t.Helper()
+	server.Logger = logger.Logger{Output: io.Discard}
+	if err := server.Prepare(module); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return listener.Addr().String()
+}
+
+// testHTTP2Exchanges sends a request with a body and a streamed request through the transport.
+func testHTTP2Exchanges(t *testing.T, client *http.Client, baseURL string, proceed chan struct{}) {
+	response, err := client.Post(baseURL+"/h2/echo", "text/plain", strings.NewReader("hello over h2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.ProtoMajor != 2 {
+		t.Errorf("echo served over %s, want HTTP/2", response.Proto)
+	}
+	if string(body) != "HTTP/2.0 hello over h2" {
+		t.Errorf("echo body = %q, want %q", body, "HTTP/2.0 hello over h2")
+	}
+
+	response, err = client.Get(baseURL + "/h2/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.ProtoMajor != 2 || response.StatusCode != 200 {
+		t.Fatalf("stream answered %s over %s, want 200 over HTTP/2", response.Status, response.Proto)
+	}
+	reader := bufio.NewReader(response.Body)
+	// The first chunk arrives while the handler is still waiting: the body is streamed, not buffered.
+	if line, err := reader.ReadString('\n'); err != nil || line != "first\n" {
+		t.Fatalf("first chunk = %q, %v", line, err)
+	}
+	close(proceed)
+	if rest, err := io.ReadAll(reader); err != nil || string(rest) != "second\n" {
+		t.Errorf("rest of the stream = %q, %v", rest, err)
+	}
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	certificate, pool := selfSignedCertificate(t)
+	server := &Server{TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}}}
+	tlsConfig, err := server.tlsConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proceed := make(chan struct{})
+	addr := startHTTP2TestServer(t, server, http2TestModule(proceed), tlsConfig)
+
+	transport := &http2.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	defer transport.CloseIdleConnections()
+	testHTTP2Exchanges(t, &http.Client{Transport: transport, Timeout: 5 * time.Second}, "https://"+addr, proceed)
+}
+
+func TestHTTP2CleartextPriorKnowledge(t *testing.T) {
+	proceed := make(chan struct{})
+	addr := startHTTP2TestServer(t, &Server{H2C: true}, http2TestModule(proceed), nil)
+
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	testHTTP2Exchanges(t, &http.Client{Transport: transport, Timeout: 5 * time.Second}, "http://"+addr, proceed)
+}
+
+func TestHTTP2DisabledFallsBackToHTTP1(t *testing.T) {
+	certificate, pool := selfSignedCertificate(t)
+	server := &Server{DisableHTTP2: true, TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificate}}}
+	tlsConfig, err := server.tlsConfig("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startHTTP2TestServer(t, server, http2TestModule(nil), tlsConfig)
+
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}
+	defer transport.CloseIdleConnections()
+	response, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Post("https://"+addr+"/h2/echo", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.ProtoMajor != 1 || string(body) != "HTTP/1.1 hello" {
+		t.Errorf("response over %s with body %q, want HTTP/1.1 with body %q", response.Proto, body, "HTTP/1.1 hello")
+	}
+}
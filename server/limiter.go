@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/tracing"
+)
+
+// DefaultRetryAfter is the delay advertised by 503 responses when Server.RetryAfter is zero.
+const DefaultRetryAfter = time.Second
+
+// AdaptiveLimit adjusts the in-flight request limit from the observed latency of the handlers, between MinLimit
+// and Server.MaxInFlight (additive increase, multiplicative decrease). The limit is multiplied by Backoff when
+// a request takes longer than TargetLatency, at most once per TargetLatency, and grows by one after as many
+// fast requests as the current limit.
+type AdaptiveLimit struct {
+	MinLimit      int           // Lower bound of the limit, 1 when zero.
+	TargetLatency time.Duration // Latency above which the limit is decreased.
+	Backoff       float64       // Factor applied to the limit when a request is too slow, 0.9 when zero.
+}
+
+// limiter is a counting semaphore with a FIFO queue of waiters, whose capacity can be adapted to the latency.
+type limiter struct {
+	mutex        sync.Mutex
+	limit        int
+	maxLimit     int
+	active       int
+	waiters      []chan struct{} // Closed, in order, when a slot is granted.
+	adaptive     *AdaptiveLimit
+	successes    int       // Fast requests since the last change of the limit.
+	lastDecrease time.Time // Time of the last decrease of the limit.
+}
+
+func newLimiter(limit int, adaptive *AdaptiveLimit) *limiter {
+	return &limiter{limit: limit, maxLimit: limit, adaptive: adaptive}
+}
+
+// acquire takes a slot, waiting at most timeout, or until ctx is done, for one to be released.
+// It reports whether a slot was taken.
+func (limiter *limiter) acquire(ctx context.Context, timeout time.Duration) bool {
+	limiter.mutex.Lock()
+	if limiter.active < limiter.limit && len(limiter.waiters) == 0 {
+		limiter.active++
+		limiter.mutex.Unlock()
+		return true
+	}
+	if timeout <= 0 {
+		limiter.mutex.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	limiter.waiters = append(limiter.waiters, ready)
+	limiter.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	select {
+	case <-ready:
+		return true // The slot was granted while giving up.
+	default:
+	}
+	for index, waiter := range limiter.waiters {
+		if waiter == ready {
+			limiter.waiters = append(limiter.waiters[:index], limiter.waiters[index+1:]...)
+			break
+		}
+	}
+	return false
+}
+
+// release frees a slot. A positive latency is the duration of the work done with the slot,
+// used to adapt the limit.
+func (limiter *limiter) release(latency time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.active--
+	if limiter.adaptive != nil && latency > 0 {
+		limiter.adapt(latency)
+	}
+	limiter.grant()
+}
+
+// adapt increases or decreases the limit according to the latency of a request.
+func (limiter *limiter) adapt(latency time.Duration) {
+	adaptive := limiter.adaptive
+	if latency > adaptive.TargetLatency {
+		if time.Since(limiter.lastDecrease) < adaptive.TargetLatency {
+			return
+		}
+		backoff := adaptive.Backoff
+		if backoff <= 0 || backoff >= 1 {
+			backoff = 0.9
+		}
+		minLimit := adaptive.MinLimit
+		if minLimit <= 0 {
+			minLimit = 1
+		}
+		limiter.limit = int(math.Max(float64(minLimit), math.Floor(float64(limiter.limit)*backoff)))
+		limiter.successes, limiter.lastDecrease = 0, time.Now()
+		return
+	}
+	if limiter.successes++; limiter.successes >= limiter.limit && limiter.limit < limiter.maxLimit {
+		limiter.limit++
+		limiter.successes = 0
+	}
+}
+
+// grant hands the free slots to the waiters, in order.
+func (limiter *limiter) grant() {
+	for limiter.active < limiter.limit && len(limiter.waiters) > 0 {
+		close(limiter.waiters[0])
+		limiter.waiters = limiter.waiters[1:]
+		limiter.active++
+	}
+}
+
+// initLimiters creates the connection and in-flight request limiters from the options of the server.
+func (server *Server) initLimiters() {
+	if server.MaxConnections > 0 && server.connectionLimiter == nil {
+		server.connectionLimiter = newLimiter(server.MaxConnections, nil)
+	}
+	if server.MaxInFlight > 0 && server.requestLimiter == nil {
+		server.requestLimiter = newLimiter(server.MaxInFlight, server.AdaptiveLimit)
+	}
+}
+
+// serveConnection serves a connection within the connection limit. When no slot is free after QueueTimeout,
+// the connection is answered with 503 and closed.
+func (server *Server) serveConnection(conn net.Conn) {
+	defer server.metrics.connectionOpened()()
+	if server.connectionLimiter != nil {
+		if !server.connectionLimiter.acquire(server.rootContext(), server.QueueTimeout) {
+			defer conn.Close()
+			server.logger().Warn(fmt.Sprintf("Connection limit reached, rejecting %s", conn.RemoteAddr()), "ServerCore")
+			conn.SetWriteDeadline(deadline(time.Second))
+			// The request is not read: it is completed, e.g., written to the access log, without its method and path.
+			request := server.partialRequest(conn, "", time.Now())
+			response := server.overloadedResponse()
+			written := server.handleResponse(&conn, request, &response)
+			server.completeRequest(request, response, written)
+			return
+		}
+		defer server.connectionLimiter.release(0)
+	}
+	server.readBuffer(conn)
+}
+
+// dispatch routes the request within the in-flight request limit, and answers 503 when no slot is free
+// after QueueTimeout. The slot is held while the handler runs: streamed and hijacked responses release
+// it once the handler has returned.
+func (server *Server) dispatch(request core.Request) core.Response {
+	defer server.metrics.requestStarted()()
+	if server.requestLimiter == nil {
+		return server.handle(request)
+	}
+	if !server.requestLimiter.acquire(request.Context(), server.QueueTimeout) {
+		server.logger().Warn(fmt.Sprintf("In-flight request limit reached, rejecting %s [%s]", request.RemoteAddr, request.ID), "ServerCore")
+		return server.overloadedResponse()
+	}
+	startTime := time.Now()
+	defer func() {
+		server.requestLimiter.release(time.Since(startTime))
+	}()
+	return server.handle(request)
+}
+
+// handle routes the request. A panic of the handler is logged with its stack and answered with 500.
+func (server *Server) handle(request core.Request) (response core.Response) {
+	span := tracing.FromRequest(request)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			server.metrics.panicRecovered()
+			server.logger().Error(fmt.Sprintf("Panic handling %s {{ %s }} [%s]: %v\n%s", request.Method, request.Endpoint, request.ID, recovered, debug.Stack()), "RequestHandler")
+			span.AddEvent("exception", map[string]interface{}{"exception.message": fmt.Sprint(recovered)})
+			response = core.Response{Content: "Internal Server Error", ContentType: core.PLAINTEXT, StatusCode: 500, StatusText: "Internal Server Error"}
+		}
+		span.AddEvent(eventHandled, nil)
+	}()
+	return server.handleRequest(&server.routeTree, request)
+}
+
+// overloadedResponse returns the 503 response sent when a limit is reached.
+func (server *Server) overloadedResponse() core.Response {
+	retryAfter := server.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+	response := core.Response{Content: "Service Unavailable", ContentType: core.PLAINTEXT, StatusCode: 503, StatusText: "Service Unavailable"}
+	response.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return response
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+)
+
+// waitForWaiters waits until the limiter has the given number of queued waiters.
+func waitForWaiters(t *testing.T, limiter *limiter, count int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		limiter.mutex.Lock()
+		waiters := len(limiter.waiters)
+		limiter.mutex.Unlock()
+		if waiters == count {
+			return
+		}
+	}
+	t.Fatalf("limiter does not have %d waiters", count)
+}
+
+func TestLimiterFIFO(t *testing.T) {
+	limiter := newLimiter(1, nil)
+	if !limiter.acquire(context.Background(), 0) {
+		t.Fatal("first acquire failed")
+	}
+	order := make(chan int, 5)
+	for index := 0; index < cap(order); index++ {
+		go func(index int) {
+			if limiter.acquire(context.Background(), time.Second) {
+				order <- index
+				limiter.release(0)
+			}
+		}(index)
+		// Each waiter is queued before the next one starts, so that the queue order is known.
+		waitForWaiters(t, limiter, index+1)
+	}
+	if limiter.acquire(context.Background(), 0) {
+		t.Fatal("acquire without waiting succeeded while waiters are queued")
+	}
+	limiter.release(0)
+	for want := 0; want < cap(order); want++ {
+		if got := <-order; got != want {
+			t.Fatalf("waiter %d acquired before waiter %d", got, want)
+		}
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	limiter := newLimiter(1, nil)
+	limiter.acquire(context.Background(), 0)
+
+	startTime := time.Now()
+	if limiter.acquire(context.Background(), 20*time.Millisecond) {
+		t.Fatal("acquire succeeded while the slot is taken")
+	}
+	if elapsed := time.Since(startTime); elapsed < 20*time.Millisecond {
+		t.Errorf("acquire gave up after %s, want at least the queue timeout", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if limiter.acquire(ctx, time.Second) {
+		t.Fatal("acquire succeeded with a cancelled context")
+	}
+	waitForWaiters(t, limiter, 0)
+
+	limiter.release(0)
+	if !limiter.acquire(context.Background(), 0) {
+		t.Error("acquire failed after the slot was released")
+	}
+}
+
+func TestInFlightLimitAnswers503(t *testing.T) {
+	started, unblock := make(chan struct{}), make(chan struct{})
+	controller := &core.Controller{Name: "Slow", Path: "slow"}
+	controller.AddRoute(core.GET, "", func(request core.Request) core.Response {
+		started <- struct{}{}
+		<-unblock
+		return core.Response{Content: "done", ContentType: core.PLAINTEXT}
+	})
+	server := &Server{Logger: logger.Logger{Output: io.Discard}, MaxInFlight: 1, QueueTimeout: 20 * time.Millisecond, RetryAfter: 2 * time.Second}
+	if err := server.Prepare(&core.Module{Controllers: []*core.Controller{controller}}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown(context.Background())
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest("GET", "/slow", nil))
+		first <- recorder
+	}()
+	<-started
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/slow", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("queued request answered %d, want 503", recorder.Code)
+	}
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("Retry-After is %q, want 2", retryAfter)
+	}
+
+	close(unblock)
+	if recorder := <-first; recorder.Code != http.StatusOK || recorder.Body.String() != "done" {
+		t.Errorf("first request answered %d %q, want 200 done", recorder.Code, recorder.Body.String())
+	}
+	go func() { <-started }()
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/slow", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("request after the slot was released answered %d, want 200", recorder.Code)
+	}
+}
+
+func TestAdaptiveLimit(t *testing.T) {
+	limiter := newLimiter(10, &AdaptiveLimit{MinLimit: 2, TargetLatency: 10 * time.Millisecond, Backoff: 0.5})
+	serve := func(latency time.Duration) {
+		t.Helper()
+		if !limiter.acquire(context.Background(), 0) {
+			t.Fatal("acquire failed")
+		}
+		limiter.release(latency)
+	}
+	// allowDecrease makes the last decrease old enough for the next one, without sleeping.
+	allowDecrease := func() {
+		limiter.lastDecrease = time.Now().Add(-time.Second)
+	}
+
+	serve(20 * time.Millisecond)
+	if limiter.limit != 5 {
+		t.Fatalf("limit after a slow request is %d, want 5", limiter.limit)
+	}
+	serve(20 * time.Millisecond)
+	if limiter.limit != 5 {
+		t.Fatalf("limit decreased twice within TargetLatency, to %d", limiter.limit)
+	}
+	allowDecrease()
+	serve(20 * time.Millisecond)
+	allowDecrease()
+	serve(20 * time.Millisecond)
+	if limiter.limit != 2 {
+		t.Fatalf("limit after slow requests is %d, want MinLimit 2", limiter.limit)
+	}
+
+	// The limit grows by one after as many fast requests as the current limit.
+	for _, want := range []int{3, 4, 5} {
+		for request := 1; request < limiter.limit; request++ {
+			serve(time.Millisecond)
+		}
+		if limiter.limit == want {
+			t.Fatalf("limit grew to %d before %d fast requests", want, want-1)
+		}
+		serve(time.Millisecond)
+		if limiter.limit != want {
+			t.Fatalf("limit is %d, want %d", limiter.limit, want)
+		}
+	}
+	serve(0)
+	if limiter.successes != 0 {
+		t.Errorf("a release without latency counted as a fast request")
+	}
+
+	for request := 0; request < 100; request++ {
+		serve(time.Millisecond)
+	}
+	if limiter.limit != 10 {
+		t.Errorf("limit is %d after many fast requests, want MaxInFlight 10", limiter.limit)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+// DefaultMaxHeaderBytes is the maximum size of the head of a request when Server.MaxHeaderBytes is zero.
+const DefaultMaxHeaderBytes = 1 << 20
+
+// DefaultMaxBodyBytes is the maximum size of the body of a request when Server.MaxBodyBytes is zero.
+const DefaultMaxBodyBytes = 10 << 20
+
+// errHeaderTooLarge is returned when the head of a request exceeds the maximum header size.
+var errHeaderTooLarge = errors.New("request header too large")
+
+// errInvalidContentLength is returned for a Content-Length header that is not a non-negative integer.
+var errInvalidContentLength = errors.New("invalid Content-Length header")
+
+// deadline returns the time at which an operation started now must end, the zero time (no deadline) when timeout is not positive.
+func deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// readHeaderTimeout returns the time allowed to read the head of a request, falling back to ReadTimeout.
+func (server *Server) readHeaderTimeout() time.Duration {
+	if server.ReadHeaderTimeout > 0 {
+		return server.ReadHeaderTimeout
+	}
+	return server.ReadTimeout
+}
+
+// idleTimeout returns the time a connection may stay open before sending a request, falling back to the header timeout.
+func (server *Server) idleTimeout() time.Duration {
+	if server.IdleTimeout > 0 {
+		return server.IdleTimeout
+	}
+	return server.readHeaderTimeout()
+}
+
+// maxHeaderBytes returns the maximum size of the head of a request.
+func (server *Server) maxHeaderBytes() int {
+	if server.MaxHeaderBytes > 0 {
+		return server.MaxHeaderBytes
+	}
+	return DefaultMaxHeaderBytes
+}
+
+// maxBodyBytes returns the maximum size of the body of a request to the endpoint, or a negative value for no limit.
+// The limit of the matching route takes precedence over the limit of the server.
+func (server *Server) maxBodyBytes(method, endpoint string) int64 {
+	if node := server.matchRoute(&server.routeTree, method, endpoint, nil); node != nil && node.MaxBodyBytes != 0 {
+		return node.MaxBodyBytes
+	}
+	if server.MaxBodyBytes != 0 {
+		return server.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// readHead reads the head of a request up to and including the first empty line,
+// and returns the value of its Content-Length header. It fails with errHeaderTooLarge after maxBytes bytes.
+func (server *Server) readHead(reader *bufio.Reader, maxBytes int) (string, int64, error) {
+	var head strings.Builder
+	var contentLength int64
+	size := 0
+	for {
+		// ReadSlice returns at most the size of the buffer, so that long lines are checked against the limit.
+		var line []byte
+		for {
+			fragment, err := reader.ReadSlice('\n')
+			if size += len(fragment); size > maxBytes {
+				return head.String(), 0, errHeaderTooLarge
+			}
+			line = append(line, fragment...)
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil {
+				head.Write(line)
+				return head.String(), 0, err
+			}
+			break
+		}
+		trimmedLine := strings.TrimRight(string(line), "\r\n")
+		if trimmedLine == "" {
+			// Empty lines received before the request line are ignored.
+			if head.Len() == 0 {
+				continue
+			}
+			head.Write(line)
+			return head.String(), contentLength, nil
+		}
+		head.Write(line)
+		name, value, found := strings.Cut(trimmedLine, ":")
+		if found && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil || length < 0 {
+				return head.String(), 0, errInvalidContentLength
+			}
+			contentLength = length
+		}
+	}
+}
+
+// readBody reads a body of the given length.
+func (server *Server) readBody(reader *bufio.Reader, length int64) ([]byte, error) {
+	body := make([]byte, length)
+	n, err := io.ReadFull(reader, body)
+	return body[:n], err
+}
+
+// isTimeout reports whether err is a network timeout, e.g., an expired read deadline.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// rejectRequest answers a request that cannot be read with an error status and closes the connection.
+// The request is completed, e.g., written to the access log, with the parts of its head that could be parsed.
+func (server *Server) rejectRequest(conn net.Conn, head string, startTime time.Time, statusCode int, statusText string, reason error) {
+	server.logger().Warn(fmt.Sprintf("%d %s from %s: %v", statusCode, statusText, conn.RemoteAddr(), reason), "ServerCore")
+	conn.SetWriteDeadline(deadline(time.Second))
+	request := server.partialRequest(conn, head, startTime)
+	response := core.Response{Content: statusText, ContentType: core.PLAINTEXT, StatusCode: statusCode, StatusText: statusText}
+	written := server.handleResponse(&conn, request, &response)
+	server.completeRequest(request, response, written)
+}
+
+// partialRequest returns the request of a head that was not fully read or not accepted, with the parts
+// that could be parsed. The response is sent in HTTP/1.1 unless the client speaks HTTP/1.0.
+func (server *Server) partialRequest(conn net.Conn, head string, startTime time.Time) core.Request {
+	method, requestURI, endpoint, protocol, headers, query, _ := server.extractHeadData(head)
+	if protocol != "HTTP/1.0" {
+		protocol = "HTTP/1.1"
+	}
+	if headers == nil {
+		headers = make(core.Header)
+	}
+	request := core.Request{Method: method, RequestURI: requestURI, Endpoint: endpoint, Protocol: protocol, Headers: headers, Query: query}
+	server.setMetadata(&request, conn, startTime)
+	return request
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/metrics"
+)
+
+// serverMetrics holds the built-in metrics of a server. Its methods do nothing on a nil receiver,
+// so that servers without a Metrics registry are not instrumented.
+type serverMetrics struct {
+	requests        *metrics.Counter
+	duration        *metrics.Histogram
+	inFlight        *metrics.Gauge
+	connections     *metrics.Gauge
+	requestBytes    *metrics.Counter
+	responseBytes   *metrics.Counter
+	panicsRecovered *metrics.Counter
+}
+
+// initMetrics registers the built-in metrics of the server in its Metrics registry.
+func (server *Server) initMetrics() {
+	if server.Metrics == nil || server.metrics != nil {
+		return
+	}
+	registry := server.Metrics
+	server.metrics = &serverMetrics{
+		requests:        registry.NewCounter("sprint_http_requests_total", "Number of HTTP requests served.", "method", "route", "status"),
+		duration:        registry.NewHistogram("sprint_http_request_duration_seconds", "Duration of the HTTP requests, from their first byte to the end of the response.", nil, "method", "route", "status"),
+		inFlight:        registry.NewGauge("sprint_http_requests_in_flight", "Number of HTTP requests being handled."),
+		connections:     registry.NewGauge("sprint_connections_open", "Number of open connections."),
+		requestBytes:    registry.NewCounter("sprint_http_request_bytes_total", "Number of body bytes read from HTTP requests, without their transfer coding; rejected requests are not read."),
+		responseBytes:   registry.NewCounter("sprint_http_response_bytes_total", "Number of body bytes written to HTTP responses, without their transfer coding."),
+		panicsRecovered: registry.NewCounter("sprint_panics_recovered_total", "Number of panics of handlers recovered by the server."),
+	}
+}
+
+// connectionOpened counts a connection until the returned function is called.
+func (serverMetrics *serverMetrics) connectionOpened() func() {
+	if serverMetrics == nil {
+		return func() {}
+	}
+	serverMetrics.connections.Inc()
+	return func() { serverMetrics.connections.Dec() }
+}
+
+// requestStarted counts a request in flight until the returned function is called.
+func (serverMetrics *serverMetrics) requestStarted() func() {
+	if serverMetrics == nil {
+		return func() {}
+	}
+	serverMetrics.inFlight.Inc()
+	return func() { serverMetrics.inFlight.Dec() }
+}
+
+// knownMethods are the methods labelled as such; the other ones share the "OTHER" label,
+// so that arbitrary methods sent by clients do not create series.
+var knownMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true}
+
+// requestCompleted records a served request. route is the template of the matched route, "" when none matched.
+func (serverMetrics *serverMetrics) requestCompleted(request core.Request, route string, statusCode int, written int64, duration time.Duration) {
+	if serverMetrics == nil {
+		return
+	}
+	// Unmatched requests share a label, so that arbitrary paths do not create series.
+	if route == "" {
+		route = "unmatched"
+	} else {
+		route = "/" + route
+	}
+	method := request.Method
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	status := strconv.Itoa(statusCode)
+	serverMetrics.requests.Inc(method, route, status)
+	serverMetrics.duration.Observe(duration.Seconds(), method, route, status)
+	// Bodies are read in full before routing, so RawBody holds every body byte read from the client.
+	serverMetrics.requestBytes.Add(float64(len(request.RawBody)))
+	serverMetrics.responseBytes.Add(float64(written))
+}
+
+// panicRecovered counts a recovered panic.
+func (serverMetrics *serverMetrics) panicRecovered() {
+	if serverMetrics == nil {
+		return
+	}
+	serverMetrics.panicsRecovered.Inc()
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+	"github.com/zlorgoncho1/sprint/metrics"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	controller := &core.Controller{Name: "Users", Path: "users"}
+	controller.AddRoute(core.GET, ":id", func(request core.Request) core.Response {
+		return core.Response{Content: "user " + request.Params["id"], ContentType: core.PLAINTEXT}
+	})
+	registry := metrics.NewRegistry()
+	server := &Server{Logger: logger.Logger{Output: io.Discard}, Metrics: registry}
+	if err := server.Prepare(&core.Module{Controllers: []*core.Controller{controller}}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown(context.Background())
+
+	for _, request := range []struct{ method, target string }{
+		{"GET", "/users/1"},
+		{"GET", "/users/2"},
+		{"GET", "/missing"},
+		{"PURGE", "/missing"},
+		{"BREW", "/users/1"},
+	} {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.target, nil))
+	}
+
+	var output strings.Builder
+	registry.WriteTo(&output)
+	for _, want := range []string{
+		// Routes are labelled by their template, unknown methods share the OTHER label.
+		`sprint_http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`sprint_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`sprint_http_requests_total{method="OTHER",route="unmatched",status="404"} 1`,
+		`sprint_http_requests_total{method="OTHER",route="unmatched",status="405"} 1`,
+		`sprint_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 2`,
+		"sprint_http_response_bytes_total 48",
+		"sprint_http_requests_in_flight 0",
+	} {
+		if !strings.Contains(output.String(), want+"\n") {
+			t.Errorf("metrics do not contain %q:\n%s", want, output.String())
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/utils"
+)
+
+// hopByHopHeaders are connection-specific headers, which are not forwarded to net/http
+// as it manages the connection itself (and HTTP/2 forbids them).
+var hopByHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade"}
+
+// Handler resolves the routes of the main module, starts the providers of its modules and returns
+// the server as an http.Handler, to run the application under an http.Server or httptest instead of Start.
+// Shutdown stops the providers.
+func (server *Server) Handler(mainModule *core.Module) (http.Handler, error) {
+	if err := server.Prepare(mainModule); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// ServeHTTP implements http.Handler with the routes resolved by Handler, Start or StartTLS.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.serveHTTP(w, r)
+}
+
+// serveHTTP handles a request received through net/http, e.g., an HTTP/2 stream, with the route tree of the server.
+// The request is converted to a core.Request and the core.Response is written back to w.
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	tooLarge := false
+	if limit := server.maxBodyBytes(r.Method, strings.TrimPrefix(r.URL.Path, "/")); limit >= 0 && r.Body != nil {
+		if r.ContentLength > limit {
+			tooLarge = true
+			r.Body = http.NoBody // The body is rejected without being read.
+		} else {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+	}
+	request, err := server.fromHTTPRequest(r)
+	request.StartTime = startTime
+	server.setRequestID(&request)
+	if err != nil {
+		server.logger().Error(fmt.Sprintf("%s [%s]", err.Error(), request.ID), "ServerCore")
+	}
+	var maxBytesErr *http.MaxBytesError
+	if tooLarge || errors.As(err, &maxBytesErr) {
+		server.rejectHTTPRequest(w, request, http.StatusRequestEntityTooLarge, "Payload Too Large")
+		return
+	}
+	request = server.withRequestContext(request, r.Context())
+
+	response := server.dispatch(request)
+	var written int64
+	switch {
+	case response.Hijack != nil:
+		server.hijackHTTPResponse(w, request, &response)
+	case response.Stream != nil:
+		written = server.streamHTTPResponse(w, request, &response)
+	default:
+		if _, isReader := response.Content.(io.Reader); isReader {
+			written = server.streamHTTPResponse(w, request, &response)
+		} else {
+			contentString := server.prepareResponse(request, &response)
+			writeHTTPHeader(w, &response)
+			if r.Method != "HEAD" {
+				n, _ := io.WriteString(w, contentString)
+				written = int64(n)
+			}
+		}
+	}
+	server.completeRequest(request, response, written)
+}
+
+// rejectHTTPRequest answers a request received through net/http with an error status, and completes it,
+// e.g., to write it to the access log.
+func (server *Server) rejectHTTPRequest(w http.ResponseWriter, request core.Request, statusCode int, statusText string) {
+	http.Error(w, statusText, statusCode)
+	response := core.Response{Content: statusText, ContentType: core.PLAINTEXT, StatusCode: statusCode, StatusText: statusText}
+	server.completeRequest(request, response, int64(len(statusText)+1)) // http.Error ends the body with a newline.
+}
+
+// fromHTTPRequest converts a net/http request into a core.Request. The body is read and decoded
+// as for requests read from a connection; a decoding error is returned along with the request.
+func (server *Server) fromHTTPRequest(r *http.Request) (core.Request, error) {
+	headers := core.Header(r.Header.Clone())
+	if r.Host != "" {
+		headers.Set("Host", r.Host)
+	}
+	var query []string
+	if r.URL.RawQuery != "" {
+		query = strings.Split(r.URL.RawQuery, "&")
+	}
+	request := core.Request{
+		Method:        r.Method,
+		Endpoint:      strings.TrimPrefix(r.URL.Path, "/"),
+		Protocol:      r.Proto,
+		Params:        make(map[string]string),
+		Headers:       headers,
+		Query:         query,
+		RemoteAddr:    r.RemoteAddr,
+		TLS:           r.TLS,
+		RequestURI:    r.RequestURI,
+		ContentLength: r.ContentLength,
+	}
+	if localAddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		request.LocalAddr = localAddr.String()
+	}
+	if r.Body == nil {
+		return request, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	if len(data) > 0 {
+		request.RawBody = data
+		request.Body, err = server.parseBody(headers, string(data))
+	}
+	return request, err
+}
+
+// streamHTTPResponse sends the headers, then streams the body of the response through w,
+// flushing it whenever the StreamFunc calls Flush. It returns the number of body bytes written.
+func (server *Server) streamHTTPResponse(w http.ResponseWriter, request core.Request, response *core.Response) int64 {
+	setDefaultStatus(response)
+	if response.ContentType == "" {
+		response.ContentType = core.PLAINTEXT
+	}
+	server.mergeHeaders(request, response, utils.GetDefaultStreamHeader(response.ContentType))
+	writeHTTPHeader(w, response)
+
+	stream := response.Stream
+	if stream == nil {
+		reader := response.Content.(io.Reader)
+		stream = func(w core.StreamWriter) error {
+			if closer, ok := reader.(io.Closer); ok {
+				defer closer.Close()
+			}
+			_, err := io.Copy(w, reader)
+			return err
+		}
+	}
+	writer := &httpStreamWriter{ResponseWriter: w, timeout: server.WriteTimeout}
+	if err := stream(writer); err != nil {
+		server.logger().Error(fmt.Sprintf("Error streaming response: %s [%s]", err, request.ID), "ServerCore")
+	}
+	return writer.written
+}
+
+// hijackHTTPResponse takes over the connection of w to run the Hijack function of the response.
+// Connections that cannot be hijacked, such as HTTP/2 streams, get a 505 response instead.
+func (server *Server) hijackHTTPResponse(w http.ResponseWriter, request core.Request, response *core.Response) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "HTTP Version Not Supported", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		server.logger().Error(fmt.Sprintf("Error hijacking connection: %s [%s]", err, request.ID), "ServerCore")
+		return
+	}
+	defer conn.Close()
+	if err := buffer.Writer.Flush(); err != nil {
+		return
+	}
+	server.handleHijackResponse(conn, buffer.Reader, request, response)
+}
+
+// writeHTTPHeader copies the headers of the response to w, without the hop-by-hop ones, and sends the status code.
+func writeHTTPHeader(w http.ResponseWriter, response *core.Response) {
+	header := w.Header()
+	for key, values := range response.Headers {
+		header[key] = values
+	}
+	for _, key := range hopByHopHeaders {
+		header.Del(key)
+	}
+	w.WriteHeader(response.StatusCode)
+}
+
+// httpStreamWriter adapts an http.ResponseWriter to core.StreamWriter.
+// A positive timeout pushes the write deadline of the response back before each write, as for HTTP/1 streams.
+type httpStreamWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+	written int64 // Number of body bytes written.
+}
+
+// Write sends p as a part of the body.
+func (writer *httpStreamWriter) Write(p []byte) (int, error) {
+	writer.extendDeadline()
+	n, err := writer.ResponseWriter.Write(p)
+	writer.written += int64(n)
+	return n, err
+}
+
+// Flush sends the buffered data to the client.
+func (writer *httpStreamWriter) Flush() error {
+	writer.extendDeadline()
+	return http.NewResponseController(writer.ResponseWriter).Flush()
+}
+
+// extendDeadline sets the write deadline of the response to timeout from now.
+func (writer *httpStreamWriter) extendDeadline() {
+	if writer.timeout > 0 {
+		http.NewResponseController(writer.ResponseWriter).SetWriteDeadline(time.Now().Add(writer.timeout))
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+)
+
+func TestMatchRoute(t *testing.T) {
+	controller := &core.Controller{Name: "Router", Path: ""}
+	for _, endpoint := range []string{"", "users/:id", "users/:id/posts/:post", "users/me", "users/me/settings", "files/*", "a/b/c"} {
+		controller.AddRoute(core.GET, endpoint, func(request core.Request) core.Response { return core.Response{} })
+	}
+	server := &Server{Logger: logger.Logger{Output: io.Discard}}
+	server.routesResolver([]*core.Controller{controller})
+
+	tests := []struct {
+		endpoint string
+		route    string // Template of the matched route, "-" when none matches.
+		params   map[string]string
+	}{
+		{"", "", map[string]string{}},
+		{"users/42", "users/:id", map[string]string{"id": "42"}},
+		{"users/42/posts/7", "users/:id/posts/:post", map[string]string{"id": "42", "post": "7"}},
+		{"users/me", "users/me", map[string]string{}},
+		{"users/me/settings", "users/me/settings", map[string]string{}},
+		{"users/me/posts/7", "users/:id/posts/:post", map[string]string{"id": "me", "post": "7"}},
+		{"users/42/posts", "-", nil},
+		{"users", "-", nil},
+		{"files/css/site.css", "files/*", map[string]string{"*": "css/site.css"}},
+		{"a/b", "-", nil},
+		{"a", "-", nil},
+	}
+	for _, test := range tests {
+		params := map[string]string{}
+		node := server.matchRoute(&server.routeTree, "GET", test.endpoint, params)
+		if test.route == "-" {
+			if node != nil {
+				t.Errorf("%q matched route %q, want none", test.endpoint, node.Route)
+			}
+			continue
+		}
+		if node == nil || node.Route != test.route {
+			t.Errorf("%q matched %v, want route %q", test.endpoint, node, test.route)
+			continue
+		}
+		if len(params) != len(test.params) {
+			t.Errorf("%q params = %v, want %v", test.endpoint, params, test.params)
+		}
+		for key, value := range test.params {
+			if params[key] != value {
+				t.Errorf("%q params = %v, want %v", test.endpoint, params, test.params)
+			}
+		}
+	}
+	if node := server.matchRoute(&server.routeTree, "POST", "users/42", nil); node != nil {
+		t.Errorf("POST matched route %q, want none", node.Route)
+	}
+}
+
+func TestMatchRouteParamNames(t *testing.T) {
+	controller := &core.Controller{Name: "Router", Path: ""}
+	for _, endpoint := range []string{"users/:id", "users/:userId/posts", "users/:userId/posts/:postId", "files/:dir/*"} {
+		controller.AddRoute(core.GET, endpoint, func(request core.Request) core.Response { return core.Response{} })
+	}
+	server := &Server{Logger: logger.Logger{Output: io.Discard}}
+	server.routesResolver([]*core.Controller{controller})
+
+	tests := []struct {
+		endpoint string
+		route    string
+		params   map[string]string
+	}{
+		{"users/42", "users/:id", map[string]string{"id": "42"}},
+		{"users/42/posts", "users/:userId/posts", map[string]string{"userId": "42"}},
+		{"users/42/posts/7", "users/:userId/posts/:postId", map[string]string{"userId": "42", "postId": "7"}},
+		{"files/css/site/main.css", "files/:dir/*", map[string]string{"dir": "css", "*": "site/main.css"}},
+	}
+	for _, test := range tests {
+		params := map[string]string{}
+		node := server.matchRoute(&server.routeTree, "GET", test.endpoint, params)
+		if node == nil || node.Route != test.route {
+			t.Errorf("%q matched %v, want route %q", test.endpoint, node, test.route)
+			continue
+		}
+		if len(params) != len(test.params) {
+			t.Errorf("%q params = %v, want %v", test.endpoint, params, test.params)
+		}
+		for key, value := range test.params {
+			if params[key] != value {
+				t.Errorf("%q params = %v, want %v", test.endpoint, params, test.params)
+			}
+		}
+	}
+
+	var tree strings.Builder
+	if err := server.WriteRouteTree(&tree); err != nil {
+		t.Fatal(err)
+	}
+	want := `GET
+  files
+    :dir
+      * => /files/:dir/*
+  users
+    :id => /users/:id
+      posts => /users/:userId/posts
+        :postId => /users/:userId/posts/:postId
+`
+	if tree.String() != want {
+		t.Errorf("route tree is\n%s\nwant\n%s", tree.String(), want)
+	}
+}
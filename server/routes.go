@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+// RouteInfo describes a route of the route tree.
+type RouteInfo struct {
+	Method       string
+	Path         string        // Template of the route, e.g., "/users/:id".
+	Controller   string        // Name of the controller declaring the route.
+	Timeout      time.Duration // See core.Route.Timeout.
+	MaxBodyBytes int64         // See core.Route.MaxBodyBytes.
+}
+
+// Routes returns the routes resolved by Start, StartTLS or Prepare, in the order they were declared.
+func (server *Server) Routes() []RouteInfo {
+	return append([]RouteInfo(nil), server.routes...)
+}
+
+// WriteRouteTree writes the route tree as indented text, one node per line, methods first.
+// Nodes ending a route are followed by its template, e.g.:
+//
+//	GET
+//	  users
+//	    :id => /users/:id
+func (server *Server) WriteRouteTree(w io.Writer) error {
+	for _, method := range sortedNodeKeys(server.routeTree.NextNodeMap) {
+		if _, err := fmt.Fprintln(w, method); err != nil {
+			return err
+		}
+		if err := writeRouteNodes(w, server.routeTree.NextNodeMap[method]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRouteNodes writes the children of a node, static segments first, then the dynamic and wildcard ones.
+// The template of a route is the one it was declared with, since routes share the node of a parameter
+// at the same position, whatever its name.
+func writeRouteNodes(w io.Writer, node *core.EndpointNode) error {
+	children := make([]*core.EndpointNode, 0, len(node.NextNodeMap)+2)
+	for _, key := range sortedNodeKeys(node.NextNodeMap) {
+		children = append(children, node.NextNodeMap[key])
+	}
+	if node.DynamicNode != nil {
+		children = append(children, node.DynamicNode)
+	}
+	if node.WildcardNode != nil {
+		children = append(children, node.WildcardNode)
+	}
+	for _, child := range children {
+		line := fmt.Sprintf("%*s%s", 2*(child.Level-1), "", child.Endpoint)
+		if child.Endpoint == "" {
+			line += "/"
+		}
+		if child.Function != nil {
+			line += " => /" + child.Route
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+		if err := writeRouteNodes(w, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedNodeKeys returns the keys of a node map, sorted.
+func sortedNodeKeys(nodes map[string]*core.EndpointNode) []string {
+	keys := make([]string, 0, len(nodes))
+	for key := range nodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
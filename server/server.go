@@ -1,15 +1,27 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"strconv"
+	"sync"
 
+	"github.com/zlorgoncho1/sprint/accesslog"
 	"github.com/zlorgoncho1/sprint/core"
 	"github.com/zlorgoncho1/sprint/logger"
+	"github.com/zlorgoncho1/sprint/metrics"
+	"github.com/zlorgoncho1/sprint/tracing"
 	"github.com/zlorgoncho1/sprint/utils"
+	"golang.org/x/net/http2"
 
 	"strings"
 	"time"
@@ -17,21 +29,91 @@ import (
 
 // Server struct defines the basic properties of the server including Host, Port, and a route tree for routing.
 type Server struct {
-	Host      string
-	Port      string
-	routeTree core.EndpointNode
+	Host         string
+	Port         string
+	Logger       logger.Interface  // Destination of the logs of the server, a default logger.Logger when nil.
+	Metrics      *metrics.Registry // Registry receiving the built-in metrics of the server, e.g., request counts and latencies; none when nil.
+	Tracer       *tracing.Tracer   // Starts a server span per request, propagating W3C Trace Context; no tracing when nil.
+	AccessLog    *accesslog.Logger // Writes one line per response, including the ones of unmatched and rejected requests; none when nil.
+	Middlewares  []core.Middleware // Middlewares applied to every route, before the controller ones.
+	CookieSecret []byte            // Secret used by the signed and encrypted cookie helpers, disabled when empty.
+	// DefaultHeaders are added to every response, e.g., Server or security headers (see utils.SecurityHeaders).
+	// They are overridden by the headers the server computes (Content-Type, Content-Length, Date, ...) and by the handler's headers.
+	DefaultHeaders core.Header
+	TLSConfig      *tls.Config        // Base TLS configuration of StartTLS, cloned before use.
+	Certificates   []KeyPair          // Additional certificates served by StartTLS, selected by SNI and reloaded when they change.
+	ClientCAFile   string             // PEM bundle of the CAs trusted for client certificates, enables mutual TLS when set.
+	ClientAuth     tls.ClientAuthType // Client certificate policy of mutual TLS, RequireAndVerifyClientCert when zero.
+	// Timeouts and size limits protect the server from slow or oversized requests, answered with 408, 413 or 431.
+	// A zero timeout means no timeout.
+	ReadHeaderTimeout time.Duration // Maximum duration to read the head of a request, ReadTimeout when zero.
+	ReadTimeout       time.Duration // Maximum duration to read a whole request, from its first byte.
+	WriteTimeout      time.Duration // Maximum duration to write a response from the end of the request, or each write of a streamed body.
+	IdleTimeout       time.Duration // Maximum duration to wait for the first byte of the request of a connection, ReadHeaderTimeout when zero; HTTP/1 connections serve a single request.
+	MaxHeaderBytes    int           // Maximum size of the head of a request, DefaultMaxHeaderBytes when zero.
+	MaxBodyBytes      int64         // Maximum size of a request body, DefaultMaxBodyBytes when zero and no limit when negative.
+	// Concurrency limits shed load during traffic spikes: excess connections and requests wait for QueueTimeout,
+	// then are answered with 503 and a Retry-After header.
+	MaxConnections int            // Maximum number of connections served at once, no limit when zero.
+	MaxInFlight    int            // Maximum number of requests handled at once, no limit when zero.
+	QueueTimeout   time.Duration  // Maximum wait for a free connection or request slot, no wait when zero.
+	RetryAfter     time.Duration  // Delay advertised by the Retry-After header of 503 responses, DefaultRetryAfter when zero.
+	AdaptiveLimit  *AdaptiveLimit // Adapts the MaxInFlight limit to the latency of the handlers when set.
+	// DrainDelay is waited on Shutdown between the draining of the providers (see core.Drainer) and the closing
+	// of the listeners, so that load balancers see the failing readiness probes and stop sending traffic. No delay when zero.
+	DrainDelay time.Duration
+	// HTTP/2 is negotiated with ALPN on TLS listeners unless DisableHTTP2 is set.
+	// H2C also accepts cleartext HTTP/2, with prior knowledge or with an "Upgrade: h2c" request.
+	DisableHTTP2         bool
+	H2C                  bool
+	MaxConcurrentStreams uint32 // Maximum number of concurrent streams per HTTP/2 connection, 250 when zero.
+	routeTree            core.EndpointNode
+	routes               []RouteInfo // Routes of the route tree, in the order they were resolved.
+	cookieSigner         *core.CookieSigner
+
+	mutex        sync.Mutex
+	listeners    []net.Listener     // Listeners of Start, StartTLS and StartHTTPSRedirect, closed on Shutdown.
+	baseContext  context.Context    // Parent of every request context, cancelled on Shutdown.
+	cancel       context.CancelFunc // Cancels baseContext.
+	shuttingDown bool
+	connections  sync.WaitGroup  // Tracks the connections being served.
+	providers    []core.Provider // Started providers, stopped in reverse order on Shutdown.
+	http2Once    sync.Once
+	h2           *http2.Server // Serves HTTP/2 connections, see http2Server.
+	h1           *http.Server  // Base configuration of HTTP/2 connections, shut down to send them GOAWAY.
+
+	connectionLimiter *limiter // Bounds the connections served at once, nil without MaxConnections.
+	requestLimiter    *limiter // Bounds the requests handled at once, nil without MaxInFlight.
+	metrics           *serverMetrics
 }
 
-// __logger is a global logger instance, initialized to a default logger.
-var __logger logger.Logger = logger.Logger{}
+// ErrServerClosed is returned by Start after a call to Shutdown.
+var ErrServerClosed = errors.New("sprint: Server closed")
+
+// aLongTimeAgo is a non-zero time in the past, used to unblock pending reads on a connection.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// defaultLogger is the logger of servers without a Logger.
+var defaultLogger logger.Interface = logger.Logger{}
+
+// logger returns the logger of the server.
+func (server *Server) logger() logger.Interface {
+	if server.Logger != nil {
+		return server.Logger
+	}
+	return defaultLogger
+}
 
 // Start initiates the server to listen on the specified Host and Port.
 // It resolves routes, logs server starting, listens for incoming connections, and spawns goroutines to handle each connection.
 func (server *Server) Start(mainModule *core.Module) (net.Listener, error) {
-	__logger.Log("Starting Sprint Application ...", "ServerCore")
+	return server.start(mainModule, nil)
+}
 
-	// Resolve routes from the provided controllers in the mainModule.
-	server.routeTree = server.routesResolver(mainModule.Controllers)
+// start runs the server, wrapping the listener in TLS when tlsConfig is not nil.
+func (server *Server) start(mainModule *core.Module, tlsConfig *tls.Config) (net.Listener, error) {
+	server.logger().Log("Starting Sprint Application ...", "ServerCore")
+	modules := server.resolve(mainModule)
 
 	// Record the start time for performance logging.
 	startTime := time.Now()
@@ -40,55 +122,292 @@ func (server *Server) Start(mainModule *core.Module) (net.Listener, error) {
 	addr := server.Host + ":" + server.Port
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		__logger.Error(fmt.Sprintf("Error starting server: %v", err), "ServerCore")
+		server.logger().Error(fmt.Sprintf("Error starting server: %v", err), "ServerCore")
 		return nil, err // Return error immediately after logging the failure
 	}
+	scheme := "http"
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "https"
+	}
+
+	// Keep track of the listener and create the base context of every request.
+	server.mutex.Lock()
+	server.listeners = append(server.listeners, listener)
+	server.baseContext, server.cancel = context.WithCancel(context.Background())
+	server.mutex.Unlock()
+
+	// Start the providers of every module before accepting connections.
+	if err := server.startProviders(modules); err != nil {
+		listener.Close()
+		return nil, err
+	}
 
 	// Log the server startup time.
 	endTime := time.Now()
-	__logger.Plog("Sprint application successfully started", endTime.Sub(startTime), "ServerCore", "0", "OK")
+	server.logger().Plog("Sprint application successfully started", endTime.Sub(startTime), "ServerCore", "0", "OK")
 
 	// Log the listening address.
-	__logger.Log(fmt.Sprintf("Listening on http://%s:%s", server.Host, server.Port), "ServerCore")
+	server.logger().Log(fmt.Sprintf("Listening on %s://%s:%s", scheme, server.Host, server.Port), "ServerCore")
 
 	// Accept incoming connections in an infinite loop.
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			// Stop listening once the server has been shut down.
+			if server.isShuttingDown() {
+				return listener, ErrServerClosed
+			}
 			// Log the error if a connection cannot be accepted and continue listening.
-			__logger.Error(fmt.Sprintf("Error during connection acceptance: %v", err), "ServerCore")
+			server.logger().Error(fmt.Sprintf("Error during connection acceptance: %v", err), "ServerCore")
 			continue
 		}
+		if !server.trackConnection() {
+			conn.Close()
+			return listener, ErrServerClosed
+		}
 		// Handle each connection in a separate goroutine for concurrent processing.
-		go server.readBuffer(conn)
+		go func() {
+			defer server.connections.Done()
+			server.serveConnection(conn)
+		}()
+	}
+}
+
+// resolve builds the route tree from the controllers of the main module, and returns the main module
+// followed by the modules it imports, whose providers are started with the server.
+func (server *Server) resolve(mainModule *core.Module) []*core.Module {
+	modules := server.modulesResolver(mainModule)
+	server.routeTree = server.routesResolver(mainModule.Controllers)
+	if len(server.CookieSecret) > 0 {
+		server.cookieSigner = core.NewCookieSigner(server.CookieSecret)
+	}
+	server.initLimiters()
+	server.initMetrics()
+	return modules
+}
+
+// Prepare resolves the routes of the main module and starts the providers of its modules, without listening.
+// Connections are then served with ServeConn, or requests with ServeHTTP; Shutdown stops the providers.
+func (server *Server) Prepare(mainModule *core.Module) error {
+	modules := server.resolve(mainModule)
+	server.mutex.Lock()
+	if server.baseContext == nil {
+		server.baseContext, server.cancel = context.WithCancel(context.Background())
+	}
+	server.mutex.Unlock()
+	return server.startProviders(modules)
+}
+
+// ServeConn serves the requests of a connection accepted outside of Start, e.g., one end of a net.Pipe,
+// and closes it. It returns ErrServerClosed without serving the connection after Shutdown.
+func (server *Server) ServeConn(conn net.Conn) error {
+	if !server.trackConnection() {
+		conn.Close()
+		return ErrServerClosed
+	}
+	defer server.connections.Done()
+	server.serveConnection(conn)
+	return nil
+}
+
+// Use appends middlewares applied to every route of the server, in the order they are given.
+// It must be called before Start.
+func (server *Server) Use(middlewares ...core.Middleware) {
+	server.Middlewares = append(server.Middlewares, middlewares...)
+}
+
+// Shutdown stops the server: it drains the providers and waits for DrainDelay, then closes the listeners,
+// cancels the context of in-flight requests and waits for open connections to be closed, or for ctx to be done.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.drainProviders(ctx)
+	if server.DrainDelay > 0 {
+		timer := time.NewTimer(server.DrainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	server.mutex.Lock()
+	server.shuttingDown = true
+	listeners, cancel := server.listeners, server.cancel
+	server.mutex.Unlock()
+
+	server.logger().Log("Shutting down Sprint Application ...", "ServerCore")
+	var err error
+	for _, listener := range listeners {
+		if closeErr := listener.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	// Ask HTTP/2 clients to stop opening streams; their connections close once the streams are done.
+	_, h1 := server.http2Server()
+	h1.Shutdown(ctx)
+	if cancel != nil {
+		cancel()
+	}
+	server.stopProviders(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		server.connections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// Loggers writing asynchronously get their last messages out before the process exits.
+	if flusher, ok := server.logger().(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if server.Tracer != nil {
+		server.Tracer.Shutdown(ctx)
+	}
+	return err
+}
+
+// isShuttingDown reports whether Shutdown has been called.
+func (server *Server) isShuttingDown() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.shuttingDown
+}
+
+// trackConnection registers a new connection unless the server is shutting down.
+func (server *Server) trackConnection() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.shuttingDown {
+		return false
+	}
+	server.connections.Add(1)
+	return true
+}
+
+// rootContext returns the base context of requests, falling back to context.Background() before Start.
+func (server *Server) rootContext() context.Context {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.baseContext == nil {
+		return context.Background()
+	}
+	return server.baseContext
+}
+
+// modulesResolver returns the main module followed by the modules it imports, recursively, each module once.
+func (server *Server) modulesResolver(mainModule *core.Module) []*core.Module {
+	var modules []*core.Module
+	visited := make(map[*core.Module]bool)
+	var visit func(module *core.Module)
+	visit = func(module *core.Module) {
+		if module == nil || visited[module] {
+			return
+		}
+		visited[module] = true
+		modules = append(modules, module)
+		for _, imported := range module.Imports {
+			visit(imported)
+		}
+	}
+	visit(mainModule)
+	return modules
+}
+
+// startProviders starts the providers of the modules in order. If one fails, the ones already started are stopped.
+func (server *Server) startProviders(modules []*core.Module) error {
+	for _, module := range modules {
+		for _, provider := range module.Providers {
+			startTime := time.Now()
+			if err := provider.Start(server.rootContext()); err != nil {
+				server.logger().Error(fmt.Sprintf("Error starting provider of %s: %v", module.Name, err), "ProviderResolver")
+				server.stopProviders(context.Background())
+				return err
+			}
+			server.mutex.Lock()
+			server.providers = append(server.providers, provider)
+			server.mutex.Unlock()
+			server.logger().Plog(fmt.Sprintf("Started %T of %s", provider, module.Name), time.Since(startTime), "ProviderResolver", "0", "OK")
+		}
+	}
+	return nil
+}
+
+// drainProviders drains the started providers implementing core.Drainer, in reverse order.
+func (server *Server) drainProviders(ctx context.Context) {
+	server.mutex.Lock()
+	providers := server.providers
+	server.mutex.Unlock()
+	for i := len(providers) - 1; i >= 0; i-- {
+		if drainer, ok := providers[i].(core.Drainer); ok {
+			drainer.Drain(ctx)
+		}
+	}
+}
+
+// stopProviders stops the started providers in reverse order.
+func (server *Server) stopProviders(ctx context.Context) {
+	server.mutex.Lock()
+	providers := server.providers
+	server.providers = nil
+	server.mutex.Unlock()
+	for i := len(providers) - 1; i >= 0; i-- {
+		if err := providers[i].Stop(ctx); err != nil {
+			server.logger().Error(fmt.Sprintf("Error stopping %T: %v", providers[i], err), "ProviderResolver")
+		}
 	}
 }
 
 func (server *Server) routesResolver(controllers []*core.Controller) core.EndpointNode {
 	// Initialize the server's route tree.
 	server.routeTree = core.EndpointNode{Level: 0, NextNodeMap: make(map[string]*core.EndpointNode)}
+	server.routes = nil
 
 	for _, controller := range controllers {
-		__logger.Log(fmt.Sprintf("%s | %s", controller.Name, controller.Path), "ControllerResolver")
+		server.logger().Log(fmt.Sprintf("%s | %s", controller.Name, controller.Path), "ControllerResolver")
 
 		for _, route := range controller.Routes {
 			startTime := time.Now()
 
 			// Concatenate module, controller, and route paths.
 			fullPath := utils.JoinPaths(controller.Path, route.Endpoint)
-			route.Endpoint = fullPath
 
-			// Add the route to the server's routing tree.
-			server.addEndpoint(&server.routeTree, route)
+			// Add the route to the server's routing tree, wrapped with its timeout and middlewares.
+			// Only the node ending the route gets its handler, so that the nodes of longer routes do not match.
+			node := server.addEndpoint(&server.routeTree, &core.Route{Method: route.Method, Endpoint: fullPath})
+			node.Function, node.MaxBodyBytes, node.Route = server.buildHandler(controller, route), route.MaxBodyBytes, fullPath
+			server.routes = append(server.routes, RouteInfo{Method: string(route.Method), Path: "/" + fullPath, Controller: controller.Name, Timeout: route.Timeout, MaxBodyBytes: route.MaxBodyBytes})
 
 			endTime := time.Now()
-			__logger.Plog(fmt.Sprintf("Mapped %s, {{ %s }}", route.Method, fullPath), endTime.Sub(startTime), "ViewResolver", "0", "OK")
+			server.logger().Plog(fmt.Sprintf("Mapped %s, {{ %s }}", route.Method, fullPath), endTime.Sub(startTime), "ViewResolver", "0", "OK")
 		}
 	}
 
 	return server.routeTree
 }
 
+// buildHandler wraps the route handler with the route timeout, then with the controller and server middlewares.
+// The first middleware of a list is the outermost one.
+func (server *Server) buildHandler(controller *core.Controller, route *core.Route) core.Handler {
+	handler := core.Handler(route.Function)
+	if route.Timeout > 0 {
+		handler = core.Timeout(route.Timeout)(handler)
+	}
+	handler = chainMiddlewares(controller.Middlewares, handler)
+	return chainMiddlewares(server.Middlewares, handler)
+}
+
+// chainMiddlewares applies the middlewares to the handler so that middlewares[0] runs first.
+func chainMiddlewares(middlewares []core.Middleware, handler core.Handler) core.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
 func (server *Server) addEndpoint(node *core.EndpointNode, route *core.Route) *core.EndpointNode {
 	workingNode := node
 	if node.Level == 0 {
@@ -107,14 +426,23 @@ func (server *Server) addEndpoint(node *core.EndpointNode, route *core.Route) *c
 	if numberOfSubPath-workingNode.Level >= 0 {
 		path := routeSplited[workingNode.Level-1]
 		existingNode, exists := workingNode.NextNodeMap[path]
+		if strings.HasPrefix(path, ":") && workingNode.DynamicNode != nil {
+			// Routes with a parameter at the same position share its node: the parameter names are bound
+			// from the template of the matched route, see bindParams.
+			existingNode, exists = workingNode.DynamicNode, true
+		}
 		if exists {
 			if numberOfSubPath == 0 {
 				return existingNode
 			}
 			return server.addEndpoint(existingNode, route)
 		} else {
-			newNode := &core.EndpointNode{Endpoint: path, Level: workingNode.Level + 1, NextNodeMap: make(map[string]*core.EndpointNode), Function: route.Function}
-			if strings.HasPrefix(path, ":") {
+			newNode := &core.EndpointNode{Endpoint: path, Level: workingNode.Level + 1, NextNodeMap: make(map[string]*core.EndpointNode)}
+			if path == "*" {
+				// A wildcard matches the rest of the path, so it ends the route.
+				workingNode.WildcardNode = newNode
+				return newNode
+			} else if strings.HasPrefix(path, ":") {
 				workingNode.DynamicNode = newNode
 			} else {
 				workingNode.NextNodeMap[path] = newNode
@@ -128,17 +456,17 @@ func (server *Server) addEndpoint(node *core.EndpointNode, route *core.Route) *c
 	return workingNode
 }
 
-func (server *Server) extractHeadData(head string) (string, string, string, map[string]string, []string, error) {
+func (server *Server) extractHeadData(head string) (string, string, string, string, core.Header, []string, error) {
 	headParts := strings.Split(head, "\n")
 
 	// Ensure there is at least one line for the request line
 	if len(headParts) == 0 {
-		return "", "", "", nil, nil, errors.New("empty HTTP head")
+		return "", "", "", "", nil, nil, errors.New("empty HTTP head")
 	}
 
 	requestLine := strings.Fields(headParts[0]) // Fields automatically trims spaces and splits
 	if len(requestLine) < 3 {
-		return "", "", "", nil, nil, errors.New("invalid HTTP request line")
+		return "", "", "", "", nil, nil, errors.New("invalid HTTP request line")
 	}
 
 	method := requestLine[0]
@@ -155,15 +483,16 @@ func (server *Server) extractHeadData(head string) (string, string, string, map[
 	}
 
 	// Headers processing
-	headers := make(map[string]string)
+	headers := make(core.Header)
 	for _, unFormattedHeader := range headParts[1:] {
 		headerParts := strings.SplitN(strings.TrimSpace(unFormattedHeader), ":", 2)
 		if len(headerParts) != 2 {
 			continue // This skips malformed headers
 		}
-		headers[strings.TrimSpace(headerParts[0])] = strings.TrimSpace(headerParts[1])
+		// Repeated header lines are kept as multiple values of the same key.
+		headers.Add(strings.TrimSpace(headerParts[0]), strings.TrimSpace(headerParts[1]))
 	}
-	return method, endpoint, protocol, headers, query, nil
+	return method, _endpoint, endpoint, protocol, headers, query, nil
 }
 
 func (server *Server) extractHTTPBufferData(data string) (core.Request, error) {
@@ -180,124 +509,471 @@ func (server *Server) extractHTTPBufferData(data string) (core.Request, error) {
 		body = parts[1]
 	}
 
-	method, endpoint, protocol, headers, query, err := server.extractHeadData(head)
+	method, requestURI, endpoint, protocol, headers, query, err := server.extractHeadData(head)
 	if err != nil {
 		return core.Request{}, err
 	}
-	contentType, hasContentType := headers["Content-Type"]
-	if hasContentType {
-		if strings.HasPrefix(contentType, string(core.PLAINTEXT)) || strings.HasPrefix(contentType, string(core.HTML)) {
-		} else if strings.HasPrefix(contentType, string(core.JSON)) {
-			var jsonObj interface{}
-			err := json.Unmarshal([]byte(body.(string)), &jsonObj)
-			if err != nil {
-				return core.Request{}, err
+	var contentLength int64
+	if headers.Has("Content-Length") {
+		contentLength, _ = strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+	} else if body != nil {
+		contentLength = int64(len(body.(string)))
+	}
+	request := core.Request{Method: method, Endpoint: endpoint, Protocol: protocol, Headers: headers, Query: query, Params: make(map[string]string), RequestURI: requestURI, ContentLength: contentLength, RawBody: rawBody(data)}
+	// A body that cannot be decoded is left nil, the raw body stays available to the handler.
+	request.Body, err = server.parseBody(headers, body)
+	return request, err
+}
+
+// rawBody returns the bytes following the head of an HTTP message, nil when there are none.
+func rawBody(data string) []byte {
+	end, separatorLength := strings.Index(data, "\n\n"), 2
+	if crlf := strings.Index(data, "\r\n\r\n"); crlf >= 0 && (end < 0 || crlf < end) {
+		end, separatorLength = crlf, 4
+	}
+	if end < 0 || end+separatorLength == len(data) {
+		return nil
+	}
+	return []byte(data[end+separatorLength:])
+}
+
+// parseBody decodes the raw body of a request according to its Content-Type header.
+// JSON bodies are unmarshalled, text and HTML bodies are kept as strings.
+func (server *Server) parseBody(headers core.Header, body interface{}) (interface{}, error) {
+	if !headers.Has("Content-Type") || body == nil {
+		return body, nil
+	}
+	contentType := headers.Get("Content-Type")
+	if strings.HasPrefix(contentType, string(core.PLAINTEXT)) || strings.HasPrefix(contentType, string(core.HTML)) {
+		return body, nil
+	} else if strings.HasPrefix(contentType, string(core.JSON)) {
+		var jsonObj interface{}
+		if err := json.Unmarshal([]byte(body.(string)), &jsonObj); err != nil {
+			return nil, err
+		}
+		return jsonObj, nil
+	}
+	return nil, errors.New("ContentTypeException")
+}
+
+// watchDisconnect cancels the request context if the client closes the connection while the request is handled.
+// The returned function stops watching; it must be called before reading from the connection again.
+func (server *Server) watchDisconnect(conn net.Conn, reader *bufio.Reader, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Peek keeps any received byte in the buffer so that nothing is lost for the next reader.
+		if _, err := reader.Peek(1); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return // Watching was stopped.
 			}
-			body = jsonObj
-		} else {
-			return core.Request{}, errors.New("ContentTypeException")
+			cancel()
 		}
+	}()
+	return func() {
+		conn.SetReadDeadline(aLongTimeAgo)
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// setMetadata fills the connection and timing information of the request and assigns its ID.
+// The ID is taken from a valid X-Request-ID header when the client provides one, otherwise it is generated.
+func (server *Server) setMetadata(request *core.Request, conn net.Conn, startTime time.Time) {
+	request.RemoteAddr = conn.RemoteAddr().String()
+	request.LocalAddr = conn.LocalAddr().String()
+	request.StartTime = startTime
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		request.TLS = &state
+	}
+	server.setRequestID(request)
+}
+
+// setRequestID takes the ID of the request from a valid X-Request-ID header, or generates it.
+func (server *Server) setRequestID(request *core.Request) {
+	request.ID = request.Headers.Get("X-Request-ID")
+	if !utils.IsValidRequestID(request.ID) {
+		request.ID = utils.GenerateRequestID()
 	}
-	return core.Request{Method: method, Endpoint: endpoint, Protocol: protocol, Headers: headers, Query: query, Body: body, Params: make(map[string]string)}, nil
+}
+
+// withRequestContext returns the request with its context and the request-scoped values set by the server.
+func (server *Server) withRequestContext(request core.Request, ctx context.Context) core.Request {
+	request = request.WithContext(ctx)
+	request = core.CompletionHooksKey.Set(request, &core.CompletionHooks{})
+	if server.cookieSigner != nil {
+		request = core.CookieSignerKey.Set(request, server.cookieSigner)
+	}
+	return server.startSpan(request)
 }
 
 func (server *Server) readBuffer(conn net.Conn) {
-	startTime := time.Now()
 	defer conn.Close()
-	var req []byte
-	keep_loop := true
-	for keep_loop {
-		buffer := make([]byte, 1024)
-		conn.Read(buffer)
-		if buffer[len(buffer)-1] == 0 {
-			keep_loop = false
-		}
-		req = append(req, buffer...)
+	// Connections that send no request in time are closed; the deadline also bounds the TLS handshake.
+	conn.SetReadDeadline(deadline(server.idleTimeout()))
+	if isHTTP2, err := server.negotiatedHTTP2(conn); err != nil {
+		return // The TLS handshake failed.
+	} else if isHTTP2 {
+		server.serveHTTP2(conn, nil, nil)
+		return
+	}
+	reader := bufio.NewReader(conn)
+	if _, err := reader.Peek(1); err != nil {
+		return // The client closed the connection, or stayed idle, without sending anything.
+	}
+	startTime := time.Now()
+	conn.SetReadDeadline(deadline(server.readHeaderTimeout()))
+	if server.hasHTTP2Preface(conn, reader) {
+		server.serveHTTP2(&bufferedConn{Conn: conn, reader: reader}, nil, nil)
+		return
+	}
+
+	head, contentLength, err := server.readHead(reader, server.maxHeaderBytes())
+	switch {
+	case err == errHeaderTooLarge:
+		server.rejectRequest(conn, head, startTime, 431, "Request Header Fields Too Large", err)
+		return
+	case err == errInvalidContentLength:
+		server.rejectRequest(conn, head, startTime, 400, "Bad Request", err)
+		return
+	case isTimeout(err):
+		server.rejectRequest(conn, head, startTime, 408, "Request Timeout", err)
+		return
+	case err != nil:
+		server.logger().Error(fmt.Sprintf("Error reading request: %v", err), "ServerCore")
+		return
+	}
+	// The body limit depends on the route, so it is checked before reading the body.
+	method, _, endpoint, _, _, _, _ := server.extractHeadData(head)
+	if limit := server.maxBodyBytes(method, endpoint); limit >= 0 && contentLength > limit {
+		server.rejectRequest(conn, head, startTime, 413, "Payload Too Large", fmt.Errorf("body of %d bytes exceeds the limit of %d bytes", contentLength, limit))
+		return
 	}
-	msg := ""
-	for _, ch := range req {
-		msg += string(ch)
+	// ReadTimeout bounds the whole request, from its first byte.
+	if server.ReadTimeout > 0 {
+		conn.SetReadDeadline(startTime.Add(server.ReadTimeout))
+	}
+	body, err := server.readBody(reader, contentLength)
+	if isTimeout(err) {
+		server.rejectRequest(conn, head, startTime, 408, "Request Timeout", err)
+		return
+	} else if err != nil {
+		server.logger().Error(fmt.Sprintf("Error reading request: %v", err), "ServerCore")
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	conn.SetWriteDeadline(deadline(server.WriteTimeout))
+	msg := head + string(body)
+	if server.upgradeH2C(conn, reader, msg) {
+		return
 	}
 	request, err := server.extractHTTPBufferData(msg)
+	server.setMetadata(&request, conn, startTime)
 	if err != nil {
-		__logger.Error(string(err.Error()), "ServerCore")
+		server.logger().Error(fmt.Sprintf("%s [%s]", err.Error(), request.ID), "ServerCore")
 	}
-	response := server.handleRequest(&server.routeTree, request)
-	server.handleResponse(&conn, request.Headers["Accept"], request.Protocol, &response)
-	endTime := time.Now()
-	responseMessage := fmt.Sprintf("%s ==> %s - {{ %s }}", conn.RemoteAddr().String(), request.Method, request.Endpoint)
-	__logger.Plog(responseMessage, endTime.Sub(startTime), "RequestHandler", "2", "OK")
+
+	// Attach a context cancelled on client disconnect or server shutdown.
+	ctx, cancel := context.WithCancel(server.rootContext())
+	defer cancel()
+	request = server.withRequestContext(request, ctx)
+	stopWatching := server.watchDisconnect(conn, reader, cancel)
+	response := server.dispatch(request)
+	var written int64
+	if response.Hijack != nil {
+		// The hijacking function reads from the connection itself, and manages its own deadlines.
+		stopWatching()
+		conn.SetDeadline(time.Time{})
+		server.handleHijackResponse(conn, reader, request, &response)
+	} else {
+		// Keep watching while the response is written, so that streamed responses notice disconnections.
+		written = server.handleResponse(&conn, request, &response)
+		stopWatching()
+	}
+	server.completeRequest(request, response, written)
+}
+
+// completeRequest runs the completion hooks of a request whose response was written, and logs it.
+func (server *Server) completeRequest(request core.Request, response core.Response, written int64) {
+	completion := core.Completion{StatusCode: response.StatusCode, Bytes: written, Duration: time.Since(request.StartTime)}
+	if hooks, ok := core.CompletionHooksKey.Get(request); ok {
+		hooks.Run(completion)
+	}
+
+	statusText := response.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(response.StatusCode)
+	}
+	var route string
+	node := server.matchRoute(&server.routeTree, request.Method, request.Endpoint, nil)
+	if node != nil {
+		route = node.Route
+	}
+	server.metrics.requestCompleted(request, route, response.StatusCode, written, completion.Duration)
+	endSpan(request, response, written)
+	if server.AccessLog != nil {
+		var routeTemplate string
+		if node != nil {
+			routeTemplate = "/" + route
+		}
+		server.AccessLog.Log(request, routeTemplate, completion)
+	}
+
+	requestLogger := server.logger()
+	if l, ok := requestLogger.(logger.FieldLogger); ok && l.Structured() {
+		// Structured loggers also receive the details of the request as fields, so that they can be queried.
+		fields := logger.Fields{"request_id": request.ID, "method": request.Method, "path": "/" + request.Endpoint, "remote_addr": request.RemoteAddr, "status_code": response.StatusCode, "bytes": written}
+		if route != "" {
+			fields["route"] = "/" + route
+		}
+		requestLogger = l.With(fields)
+	}
+	responseMessage := fmt.Sprintf("%s ==> %s - {{ %s }} [%s]", request.RemoteAddr, request.Method, request.Endpoint, request.ID)
+	requestLogger.Plog(responseMessage, completion.Duration, "RequestHandler", strconv.Itoa(response.StatusCode/100), fmt.Sprintf("%d %s", response.StatusCode, statusText))
 }
 
 func (server *Server) handleRequest(node *core.EndpointNode, request core.Request) core.Response {
+	matchedNode := server.matchRoute(node, request.Method, request.Endpoint, request.Params)
+	if matchedNode == nil {
+		return server.unmatchedResponse(node, request)
+	}
+	request.Route = matchedNode.Route
+	spanRouted(request)
+	request = core.LoggerKey.Set(request, server.requestLogger(request))
+	return matchedNode.Function(request)
+}
+
+// unmatchedResponse returns the response to a request matching no route: 405 with the methods of the routes
+// matching its endpoint in the Allow header, or 404 when there are none.
+func (server *Server) unmatchedResponse(node *core.EndpointNode, request core.Request) core.Response {
+	var allowed []string
+	for _, method := range sortedNodeKeys(node.NextNodeMap) {
+		if server.matchNode(node, method, request.Endpoint) != nil {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) == 0 {
+		return core.Response{Content: "Not Found", ContentType: core.PLAINTEXT, StatusCode: 404, StatusText: "Not Found"}
+	}
+	response := core.Response{Content: "Method Not Allowed", ContentType: core.PLAINTEXT, StatusCode: 405, StatusText: "Method Not Allowed"}
+	response.Header().Set("Allow", strings.Join(allowed, ", "))
+	return response
+}
+
+// requestLogger returns the slog.Logger given to handlers, writing through the logger of the server
+// with the request ID, method and route as attributes, and the trace and span IDs of traced requests.
+func (server *Server) requestLogger(request core.Request) *slog.Logger {
+	requestLogger := slog.New(logger.NewSlogHandler(server.logger())).With(
+		slog.String(logger.ModuleKey, "RequestHandler"),
+		slog.String("request_id", request.ID),
+		slog.String("method", request.Method),
+		slog.String("route", "/"+request.Route),
+	)
+	if spanContext := tracing.FromRequest(request).SpanContext(); spanContext.IsValid() {
+		requestLogger = requestLogger.With(slog.String("trace_id", spanContext.TraceID.String()), slog.String("span_id", spanContext.SpanID.String()))
+	}
+	return requestLogger
+}
+
+// matchRoute returns the node of the route tree matching the method and endpoint, nil when there is none.
+// The values of the dynamic segments, and of the wildcard under the "*" key, are stored in params when it is not nil.
+func (server *Server) matchRoute(node *core.EndpointNode, method string, endpoint string, params map[string]string) *core.EndpointNode {
+	matchedNode := server.matchNode(node, method, endpoint)
+	if matchedNode != nil && params != nil {
+		bindParams(matchedNode.Route, endpoint, params)
+	}
+	return matchedNode
+}
+
+// matchNode returns the node ending a route that matches the method and endpoint, nil when there is none.
+func (server *Server) matchNode(node *core.EndpointNode, method string, endpoint string) *core.EndpointNode {
 	workingNode := node
 	var exists bool
 	if workingNode.Level == 0 {
-		workingNode, exists = workingNode.NextNodeMap[request.Method]
+		workingNode, exists = workingNode.NextNodeMap[method]
 		if !exists {
-			return core.Response{}
+			return nil
 		}
 	}
-	routeSplited := strings.Split(request.Endpoint, "/")
+	routeSplited := strings.Split(endpoint, "/")
 	numberOfSubPath := len(routeSplited)
-	if numberOfSubPath-workingNode.Level >= 0 {
-		path := routeSplited[workingNode.Level-1]
-		existingNode, exists := workingNode.NextNodeMap[path]
-		if !exists {
-			if workingNode.DynamicNode == nil {
-				return core.Response{}
+	if numberOfSubPath-workingNode.Level < 0 {
+		return nil
+	}
+	path := routeSplited[workingNode.Level-1]
+	// match continues with the next node; on the last segment, only a node ending a route matches.
+	match := func(nextNode *core.EndpointNode) *core.EndpointNode {
+		if numberOfSubPath-workingNode.Level == 0 {
+			if nextNode.Function == nil {
+				return nil
 			}
-			existingNode = workingNode.DynamicNode
-			request.Params[strings.TrimPrefix(existingNode.Endpoint, ":")] = path
+			return nextNode
 		}
-		if numberOfSubPath-workingNode.Level == 0 {
-			return existingNode.Function(request)
+		return server.matchNode(nextNode, method, endpoint)
+	}
+
+	// Static segments take precedence over parameters, which take precedence over a wildcard.
+	if existingNode, exists := workingNode.NextNodeMap[path]; exists {
+		if matchedNode := match(existingNode); matchedNode != nil {
+			return matchedNode
+		}
+	}
+	if workingNode.DynamicNode != nil {
+		if matchedNode := match(workingNode.DynamicNode); matchedNode != nil {
+			return matchedNode
 		}
-		return server.handleRequest(existingNode, request)
 	}
-	return core.Response{}
+	if workingNode.WildcardNode != nil {
+		return workingNode.WildcardNode
+	}
+	return nil
 }
 
-func (server *Server) handleResponse(conn *net.Conn, acceptHeader string, protocol string, response *core.Response) {
-	acceptTypes := strings.Split(acceptHeader, ",")
-	// Assuming "*/*" or matching ContentType is acceptable
-	isAcceptableType := func(content core.ContentType) bool {
-		for _, t := range acceptTypes {
-			if t == string(content) || t == "*/*" {
-				return true
-			}
+// bindParams stores in params the values of the endpoint segments at the positions of the parameters of
+// the route template, and the rest of the endpoint under the "*" key when the route ends with a wildcard.
+// Routes share the node of a parameter at the same position, so the names are taken from the matched route.
+func bindParams(route string, endpoint string, params map[string]string) {
+	routeSegments, endpointSegments := strings.Split(route, "/"), strings.Split(endpoint, "/")
+	for index, segment := range routeSegments {
+		if index >= len(endpointSegments) {
+			return
+		}
+		if segment == "*" {
+			params["*"] = strings.Join(endpointSegments[index:], "/")
+		} else if strings.HasPrefix(segment, ":") {
+			params[strings.TrimPrefix(segment, ":")] = endpointSegments[index]
 		}
-		return false
 	}
+}
 
+// handleResponse writes the response to the connection and returns the number of body bytes written.
+func (server *Server) handleResponse(conn *net.Conn, request core.Request, response *core.Response) int64 {
+	// Streamed bodies are written as they are produced instead of being formatted in memory.
+	if _, isReader := response.Content.(io.Reader); isReader || response.Stream != nil {
+		return server.handleStreamResponse(conn, request, response)
+	}
+
+	contentString := server.prepareResponse(request, response)
+	responseStatus := utils.FormatStatusResponse(response.StatusCode, response.StatusText, request.Protocol)
+	headers := utils.HeaderToHTTPHeadersResponse(response.Headers)
+
+	if request.Method == string(core.HEAD) {
+		// Responses to HEAD requests have the headers of the body, Content-Length included, but no body.
+		contentString = ""
+	}
+	if _, err := (*conn).Write(utils.FormatHTTPResponse(responseStatus, headers, contentString)); err != nil {
+		// Log or handle the error based on your application's requirements
+		server.logger().Error(fmt.Sprintf("Error writing response: %s", err), "ServerCore")
+		return 0
+	}
+	return int64(len(contentString))
+}
+
+// prepareResponse negotiates the content type of a buffered response, sets its status and headers,
+// and returns the formatted body.
+func (server *Server) prepareResponse(request core.Request, response *core.Response) string {
 	switch {
-	case response.ContentType == core.HTML && isAcceptableType(core.HTML):
+	case response.ContentType == "":
+		response.ContentType = core.PLAINTEXT
+	case !acceptable(request, response.ContentType):
+		// Content the client does not accept is sent as plain text.
+		response.ContentType = core.PLAINTEXT
+	case response.ContentType == core.HTML:
 		utils.HandleHTML(response)
-	case response.ContentType == core.JSON && isAcceptableType(core.JSON):
+	case response.ContentType == core.JSON:
 		utils.HandleJSON(response)
-	case response.ContentType == core.PLAINTEXT && isAcceptableType(core.PLAINTEXT):
-		utils.HandlePlainText(response)
-	default:
-		response.ContentType = core.PLAINTEXT
-		// Consider setting a more appropriate status code and message for unsupported content types.
 	}
+	// Other types, e.g., PLAINTEXT or the Prometheus text format, keep their content type and are sent as is.
 
+	setDefaultStatus(response)
+	// Defaults are computed from the final body, then overridden by server-wide and user-supplied headers.
+	contentString := server.FormatContentString(response.Content)
+	server.mergeHeaders(request, response, utils.GetDefaultHeader(contentString, response.ContentType))
+	return contentString
+}
+
+// acceptable reports whether the Accept header of the request allows the content type. Every type is acceptable
+// without an Accept header; media ranges such as "text/*" match, and ranges weighted with q=0 exclude.
+func acceptable(request core.Request, contentType core.ContentType) bool {
+	accept := strings.Join(request.Headers.Values("Accept"), ",")
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	mediaType, _, _ := strings.Cut(string(contentType), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	typeName, _, _ := strings.Cut(mediaType, "/")
+	for _, acceptRange := range strings.Split(accept, ",") {
+		parameters := strings.Split(acceptRange, ";")
+		acceptType := strings.ToLower(strings.TrimSpace(parameters[0]))
+		if acceptType != "*/*" && acceptType != typeName+"/*" && acceptType != mediaType {
+			continue
+		}
+		excluded := false
+		for _, parameter := range parameters[1:] {
+			if name, value, _ := strings.Cut(parameter, "="); strings.TrimSpace(name) == "q" {
+				quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				excluded = err == nil && quality == 0
+			}
+		}
+		if !excluded {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHijackResponse writes the status line and headers of the response, typically a 101 Switching Protocols,
+// then hands the connection and its buffered reader over to the Hijack function of the response.
+func (server *Server) handleHijackResponse(conn net.Conn, reader *bufio.Reader, request core.Request, response *core.Response) {
+	if response.StatusCode == 0 {
+		// The Hijack function writes the response itself.
+		response.Hijack(conn, reader)
+		return
+	}
+	setDefaultStatus(response)
+	server.mergeHeaders(request, response, core.Header{"Date": {time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")}})
+	responseStatus := utils.FormatStatusResponse(response.StatusCode, response.StatusText, request.Protocol)
+	headers := utils.HeaderToHTTPHeadersResponse(response.Headers)
+	if _, err := conn.Write(utils.FormatHTTPResponse(responseStatus, headers, "")); err != nil {
+		server.logger().Error(fmt.Sprintf("Error writing response: %s", err), "ServerCore")
+		return
+	}
+	response.Hijack(conn, reader)
+}
+
+// setDefaultStatus sets the status of responses returned without one to 200 OK.
+func setDefaultStatus(response *core.Response) {
 	if response.StatusCode == 0 {
 		response.StatusCode = 200
 	}
 	if response.StatusText == "" {
 		response.StatusText = "OK"
 	}
-	if len(response.Headers) == 0 {
-		contentString := server.FormatContentString(response.Content)
-		response.Headers = utils.GetDefaultHeader(contentString, response.ContentType)
-	}
-	responseStatus := utils.FormatStatusResponse(response.StatusCode, response.StatusText, protocol)
-	headers := utils.DictToHTTPHeadersResponse(response.Headers)
+}
 
-	if _, err := (*conn).Write(utils.FormatHTTPResponse(responseStatus, headers, server.FormatContentString(response.Content))); err != nil {
-		// Log or handle the error based on your application's requirements
-		__logger.Error(fmt.Sprintf("Error writing response: %s", err), "ServerCore")
+// framingHeaders are the headers delimiting the body of a response, ignored in Server.DefaultHeaders.
+var framingHeaders = []string{"Content-Length", "Transfer-Encoding", "Connection", "Trailer"}
+
+// mergeHeaders sets the final headers of the response: the server-wide DefaultHeaders, overridden by
+// the headers computed by the server, overridden by the headers set by the handler.
+// Defaults never replace the framing headers, e.g., Content-Length or Transfer-Encoding.
+func (server *Server) mergeHeaders(request core.Request, response *core.Response, defaults core.Header) {
+	serverDefaults := server.DefaultHeaders
+	for _, key := range framingHeaders {
+		if serverDefaults.Has(key) {
+			serverDefaults = serverDefaults.Clone()
+			for _, key := range framingHeaders {
+				serverDefaults.Del(key)
+			}
+			break
+		}
+	}
+	response.Headers = utils.MergeHeaders(serverDefaults, defaults, response.Headers)
+	// Echo the request ID so that clients can correlate responses with server logs.
+	if !response.Headers.Has("X-Request-ID") && request.ID != "" {
+		response.Headers.Set("X-Request-ID", request.ID)
 	}
 }
 
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+)
+
+func TestStructuredRequestLog(t *testing.T) {
+	// The logger of the server can be a Logger or a *Logger.
+	for _, pointer := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pointer=%v", pointer), func(t *testing.T) {
+			controller := &core.Controller{Name: "Users", Path: "users"}
+			controller.AddRoute(core.GET, ":id", func(request core.Request) core.Response {
+				request.Logger().Info("found", "user", request.Params["id"])
+				return core.Response{Content: "ok", ContentType: core.PLAINTEXT}
+			})
+			var output bytes.Buffer
+			server := &Server{Logger: logger.Logger{Output: &output, Format: logger.JSON}}
+			if pointer {
+				server.Logger = &logger.Logger{Output: &output, Format: logger.JSON}
+			}
+			if err := server.Prepare(&core.Module{Controllers: []*core.Controller{controller}}); err != nil {
+				t.Fatal(err)
+			}
+			defer server.Shutdown(context.Background())
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+
+			var handlerRecord, requestRecord map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+				var record map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("line %q is not JSON: %v", line, err)
+				}
+				if record["msg"] == "found" {
+					handlerRecord = record
+				} else if _, ok := record["status_code"]; ok {
+					requestRecord = record
+				}
+			}
+			if handlerRecord == nil || handlerRecord["user"] != "42" || handlerRecord["route"] != "/users/:id" {
+				t.Errorf("handler record is %v, want the user and route fields", handlerRecord)
+			}
+			if requestRecord == nil || requestRecord["route"] != "/users/:id" || requestRecord["status_code"] != float64(200) {
+				t.Errorf("request record is %v, want the route and status_code fields", requestRecord)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/utils"
+)
+
+// streamWriter implements core.StreamWriter on top of a connection.
+// Writes are buffered until Flush is called or the buffer is full, and are framed
+// as chunks when the length of the body is not known in advance.
+type streamWriter struct {
+	buffer  *bufio.Writer
+	chunked bool
+	written int64 // Number of body bytes written, excluding chunk framing.
+}
+
+// newStreamWriter returns a writer on the connection. A positive writeTimeout bounds each write to the connection
+// rather than the whole body, so that long-lived streams, e.g., Server-Sent Events, are not cut.
+func newStreamWriter(conn net.Conn, chunked bool, writeTimeout time.Duration) *streamWriter {
+	return &streamWriter{buffer: bufio.NewWriterSize(deadlineWriter{conn: conn, timeout: writeTimeout}, 4096), chunked: chunked}
+}
+
+// deadlineWriter writes to a connection, pushing its write deadline back by timeout before each write.
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (writer deadlineWriter) Write(p []byte) (int, error) {
+	if writer.timeout > 0 {
+		writer.conn.SetWriteDeadline(time.Now().Add(writer.timeout))
+	}
+	return writer.conn.Write(p)
+}
+
+// Write sends p as a part of the body, as a single chunk in chunked mode.
+func (writer *streamWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil // An empty chunk would end the body.
+	}
+	if writer.chunked {
+		if _, err := fmt.Fprintf(writer.buffer, "%x\r\n", len(p)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := writer.buffer.Write(p)
+	writer.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if writer.chunked {
+		_, err = writer.buffer.WriteString("\r\n")
+	}
+	return n, err
+}
+
+// Flush sends the buffered data to the client.
+func (writer *streamWriter) Flush() error {
+	return writer.buffer.Flush()
+}
+
+// close terminates the body and flushes the remaining data.
+func (writer *streamWriter) close() error {
+	if writer.chunked {
+		if _, err := writer.buffer.WriteString("0\r\n\r\n"); err != nil {
+			return err
+		}
+	}
+	return writer.buffer.Flush()
+}
+
+// handleStreamResponse writes the status line and headers, then streams the body of the response,
+// either from its Stream function or by copying its io.Reader Content.
+// The body is sent with chunked transfer encoding unless the handler set Content-Length
+// or the client speaks HTTP/1.0, in which case the end of the body is marked by closing the connection.
+// It returns the number of body bytes written.
+func (server *Server) handleStreamResponse(conn *net.Conn, request core.Request, response *core.Response) int64 {
+	setDefaultStatus(response)
+	if response.ContentType == "" {
+		response.ContentType = core.PLAINTEXT
+	}
+	server.mergeHeaders(request, response, utils.GetDefaultStreamHeader(response.ContentType))
+	chunked := !response.Headers.Has("Content-Length") && request.Protocol != "HTTP/1.0"
+	if chunked {
+		response.Headers.Set("Transfer-Encoding", "chunked")
+	} else {
+		response.Headers.Del("Transfer-Encoding")
+	}
+
+	writer := newStreamWriter(*conn, chunked, server.WriteTimeout)
+	responseStatus := utils.FormatStatusResponse(response.StatusCode, response.StatusText, request.Protocol)
+	headers := utils.HeaderToHTTPHeadersResponse(response.Headers)
+	if _, err := writer.buffer.Write(utils.FormatHTTPResponse(responseStatus, headers, "")); err != nil {
+		server.logger().Error(fmt.Sprintf("Error writing response: %s", err), "ServerCore")
+		return 0
+	}
+
+	if request.Method == string(core.HEAD) {
+		// Responses to HEAD requests have no body, not even the last chunk.
+		if closer, ok := response.Content.(io.Closer); ok && response.Stream == nil {
+			closer.Close()
+		}
+		if err := writer.Flush(); err != nil {
+			server.logger().Error(fmt.Sprintf("Error writing response: %s", err), "ServerCore")
+		}
+		return 0
+	}
+
+	stream := response.Stream
+	if stream == nil {
+		reader := response.Content.(io.Reader)
+		stream = func(w core.StreamWriter) error {
+			if closer, ok := reader.(io.Closer); ok {
+				defer closer.Close()
+			}
+			_, err := io.Copy(w, reader)
+			return err
+		}
+	}
+	if err := stream(writer); err != nil {
+		// The status line is already sent: the body is left incomplete so that the client notices the failure.
+		server.logger().Error(fmt.Sprintf("Error streaming response: %s [%s]", err, request.ID), "ServerCore")
+		writer.Flush()
+		return writer.written
+	}
+	if err := writer.close(); err != nil {
+		server.logger().Error(fmt.Sprintf("Error writing response: %s", err), "ServerCore")
+	}
+	return writer.written
+}
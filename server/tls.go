@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+	"github.com/zlorgoncho1/sprint/utils"
+)
+
+// DefaultCertificateCheckInterval is the minimum delay between two checks of the certificate files
+// of a CertificateReloader whose CheckInterval is zero.
+const DefaultCertificateCheckInterval = 10 * time.Second
+
+// KeyPair locates a PEM encoded certificate chain and its private key on disk.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertificateReloader serves certificates loaded from files and reloads them when the files change on disk,
+// without restarting the server. When several certificates are loaded, the one matching the server name
+// requested by the client (SNI) is selected, the first one being the default.
+type CertificateReloader struct {
+	CheckInterval time.Duration    // Minimum delay between two checks of the files, DefaultCertificateCheckInterval when zero.
+	Logger        logger.Interface // Destination of the reload logs, a default logger.Logger when nil.
+
+	pairs        []KeyPair
+	mutex        sync.RWMutex
+	certificates []*tls.Certificate
+	modTimes     []time.Time
+	lastCheck    time.Time
+}
+
+// NewCertificateReloader loads the given key pairs. It fails if one of them cannot be loaded.
+func NewCertificateReloader(pairs ...KeyPair) (*CertificateReloader, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("sprint: no certificate to load")
+	}
+	reloader := &CertificateReloader{pairs: pairs, certificates: make([]*tls.Certificate, len(pairs)), modTimes: make([]time.Time, len(pairs))}
+	for i := range pairs {
+		if err := reloader.load(i); err != nil {
+			return nil, err
+		}
+	}
+	reloader.lastCheck = time.Now()
+	return reloader, nil
+}
+
+// Reload reloads every key pair whose files changed since they were loaded.
+// A pair that fails to load keeps serving its previous certificate.
+func (reloader *CertificateReloader) Reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.lastCheck = time.Now()
+	var errs []error
+	for i, pair := range reloader.pairs {
+		if modTime, err := pairModTime(pair); err != nil {
+			errs = append(errs, err)
+			continue
+		} else if !modTime.After(reloader.modTimes[i]) {
+			continue
+		}
+		if err := reloader.load(i); err != nil {
+			reloader.logger().Error(fmt.Sprintf("Error reloading certificate %s: %v", pair.CertFile, err), "TLS")
+			errs = append(errs, err)
+			continue
+		}
+		reloader.logger().Log(fmt.Sprintf("Reloaded certificate %s", pair.CertFile), "TLS")
+	}
+	return errors.Join(errs...)
+}
+
+// logger returns the logger of the reloader.
+func (reloader *CertificateReloader) logger() logger.Interface {
+	if reloader.Logger != nil {
+		return reloader.Logger
+	}
+	return defaultLogger
+}
+
+// GetCertificate returns the certificate to present to a client, reloading changed files first
+// when CheckInterval has elapsed. It is meant to be used as tls.Config.GetCertificate.
+func (reloader *CertificateReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	interval := reloader.CheckInterval
+	if interval <= 0 {
+		interval = DefaultCertificateCheckInterval
+	}
+	reloader.mutex.RLock()
+	due := time.Since(reloader.lastCheck) >= interval
+	reloader.mutex.RUnlock()
+	if due {
+		reloader.Reload()
+	}
+
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	for _, certificate := range reloader.certificates {
+		if hello.SupportsCertificate(certificate) == nil {
+			return certificate, nil
+		}
+	}
+	return reloader.certificates[0], nil
+}
+
+// load loads the key pair at index i. The caller must hold the write lock, except during construction.
+func (reloader *CertificateReloader) load(i int) error {
+	pair := reloader.pairs[i]
+	modTime, err := pairModTime(pair)
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return err
+	}
+	// Parsing the leaf once avoids parsing it again on every handshake to match the server name.
+	if certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+		return err
+	}
+	reloader.certificates[i], reloader.modTimes[i] = &certificate, modTime
+	return nil
+}
+
+// pairModTime returns the latest modification time of the files of a key pair.
+func pairModTime(pair KeyPair) (time.Time, error) {
+	certInfo, err := os.Stat(pair.CertFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyInfo, err := os.Stat(pair.KeyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
+
+// StartTLS works like Start but serves HTTPS. The certificate files are reloaded when they change on disk;
+// the pairs of Server.Certificates are served too and selected by SNI. certFile and keyFile may be empty
+// when Server.Certificates or Server.TLSConfig provide the certificates.
+func (server *Server) StartTLS(mainModule *core.Module, certFile, keyFile string) (net.Listener, error) {
+	config, err := server.tlsConfig(certFile, keyFile)
+	if err != nil {
+		server.logger().Error(fmt.Sprintf("Error configuring TLS: %v", err), "ServerCore")
+		return nil, err
+	}
+	return server.start(mainModule, config)
+}
+
+// tlsConfig builds the TLS configuration of StartTLS from Server.TLSConfig, the certificate files and the client CA.
+func (server *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if server.TLSConfig != nil {
+		config = server.TLSConfig.Clone()
+	}
+
+	pairs := server.Certificates
+	if certFile != "" || keyFile != "" {
+		pairs = append([]KeyPair{{CertFile: certFile, KeyFile: keyFile}}, pairs...)
+	}
+	if len(pairs) > 0 {
+		reloader, err := NewCertificateReloader(pairs...)
+		if err != nil {
+			return nil, err
+		}
+		reloader.Logger = server.Logger
+		config.GetCertificate = reloader.GetCertificate
+	} else if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, errors.New("sprint: StartTLS requires a certificate")
+	}
+
+	// Mutual TLS: client certificates are verified and exposed to handlers through Request.TLS.
+	if server.ClientCAFile != "" {
+		pem, err := os.ReadFile(server.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("sprint: no certificate found in %s", server.ClientCAFile)
+		}
+		config.ClientAuth = server.ClientAuth
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+		if !server.DisableHTTP2 {
+			config.NextProtos = []string{"h2", "http/1.1"}
+		}
+	}
+	return config, nil
+}
+
+// StartHTTPSRedirect listens for plain HTTP on the given port of Server.Host and answers every request with a
+// 308 Permanent Redirect to the same URL over HTTPS on Server.Port. It blocks like Start, so it is usually run
+// in its own goroutine next to StartTLS, and stops on Shutdown.
+func (server *Server) StartHTTPSRedirect(port string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", server.Host+":"+port)
+	if err != nil {
+		server.logger().Error(fmt.Sprintf("Error starting HTTPS redirect: %v", err), "ServerCore")
+		return nil, err
+	}
+	server.mutex.Lock()
+	if server.shuttingDown {
+		server.mutex.Unlock()
+		listener.Close()
+		return nil, ErrServerClosed
+	}
+	server.listeners = append(server.listeners, listener)
+	server.mutex.Unlock()
+	server.logger().Log(fmt.Sprintf("Redirecting http://%s:%s to HTTPS", server.Host, port), "ServerCore")
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if server.isShuttingDown() {
+				return listener, ErrServerClosed
+			}
+			server.logger().Error(fmt.Sprintf("Error during connection acceptance: %v", err), "ServerCore")
+			continue
+		}
+		if !server.trackConnection() {
+			conn.Close()
+			return listener, ErrServerClosed
+		}
+		go func() {
+			defer server.connections.Done()
+			server.redirectToHTTPS(conn)
+		}()
+	}
+}
+
+// redirectToHTTPS answers a single request with a redirect to its HTTPS equivalent.
+func (server *Server) redirectToHTTPS(conn net.Conn) {
+	defer conn.Close()
+	conn.SetReadDeadline(deadline(server.idleTimeout()))
+	head, _, err := server.readHead(bufio.NewReader(conn), server.maxHeaderBytes())
+	if err != nil {
+		return
+	}
+	_, requestURI, _, protocol, headers, _, err := server.extractHeadData(head)
+	if err != nil || headers.Get("Host") == "" {
+		conn.Write(utils.FormatHTTPResponse(utils.FormatStatusResponse(400, "Bad Request", protocol), "Connection: close\r\nContent-Length: 0", ""))
+		return
+	}
+
+	host := headers.Get("Host")
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if server.Port != "443" {
+		host = net.JoinHostPort(host, server.Port)
+	}
+	redirectHeaders := core.Header{}
+	redirectHeaders.Set("Location", "https://"+host+requestURI)
+	redirectHeaders.Set("Content-Length", "0")
+	redirectHeaders.Set("Connection", "close")
+	responseStatus := utils.FormatStatusResponse(308, "Permanent Redirect", protocol)
+	conn.Write(utils.FormatHTTPResponse(responseStatus, utils.HeaderToHTTPHeadersResponse(redirectHeaders), ""))
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/tracing"
+)
+
+// Names of the events marking the phases of a request in its server span.
+const (
+	eventParsed   = "request.parsed"
+	eventRouted   = "route.matched"
+	eventHandled  = "handler.returned"
+	eventResponse = "response.written"
+)
+
+// startSpan starts the server span of the request, from its first byte, continuing the trace of the client
+// when the request carries a valid traceparent header. The request is returned unchanged without a Tracer.
+func (server *Server) startSpan(request core.Request) core.Request {
+	if server.Tracer == nil {
+		return request
+	}
+	parent, _ := tracing.Extract(request.Headers)
+	span := server.Tracer.Start(parent, request.Method, tracing.KindServer, request.StartTime)
+	span.SetAttribute("http.request.method", request.Method)
+	span.SetAttribute("url.path", "/"+request.Endpoint)
+	span.SetAttribute("network.protocol.version", request.Protocol)
+	span.SetAttribute("client.address", request.RemoteAddr)
+	span.SetAttribute("sprint.request_id", request.ID)
+	span.AddEvent(eventParsed, nil)
+	return tracing.SpanKey.Set(request, span)
+}
+
+// spanRouted names the server span after the matched route, e.g., "GET /users/:id".
+func spanRouted(request core.Request) {
+	span := tracing.FromRequest(request)
+	span.SetName(request.Method + " /" + request.Route)
+	span.SetAttribute("http.route", "/"+request.Route)
+	span.AddEvent(eventRouted, nil)
+}
+
+// endSpan records the outcome of the request in its server span and ends it. Responses with a 5xx status
+// mark the span as failed.
+func endSpan(request core.Request, response core.Response, written int64) {
+	span := tracing.FromRequest(request)
+	if span == nil {
+		return
+	}
+	span.AddEvent(eventResponse, nil)
+	span.SetAttribute("http.response.status_code", response.StatusCode)
+	span.SetAttribute("http.response.body.size", written)
+	if response.StatusCode >= 500 {
+		span.SetStatus(tracing.StatusError, fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode)))
+	}
+	span.End()
+}
@@ -0,0 +1,307 @@
+// Package sprinttest runs Sprint applications in memory for tests.
+//
+// Requests are written to one end of a net.Pipe and served by the other end through the same
+// pipeline as real connections, so no port is opened and tests can run in parallel:
+//
+//	func TestGetUser(t *testing.T) {
+//		t.Parallel()
+//		app := sprinttest.New(t, &core.Module{Controllers: []*core.Controller{users.Controller()}})
+//		app.Get("/users/42").Header("Accept", "application/json").Do().
+//			ExpectStatus(200).
+//			ExpectHeader("Content-Type", "application/json").
+//			ExpectJSON(map[string]interface{}{"id": "42"})
+//	}
+package sprinttest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/logger"
+	"github.com/zlorgoncho1/sprint/server"
+)
+
+// DefaultTimeout is the maximum duration of a request when App.Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// App is a Sprint application served in memory.
+type App struct {
+	Server  *server.Server // Server serving the requests, with its middlewares and options.
+	Timeout time.Duration  // Maximum duration of a request, DefaultTimeout when zero.
+
+	t testing.TB
+}
+
+// New prepares a default server for the main module. The server is shut down when the test ends.
+func New(t testing.TB, mainModule *core.Module) *App {
+	t.Helper()
+	return NewWithServer(t, &server.Server{}, mainModule)
+}
+
+// NewWithServer prepares the given server, e.g., configured with middlewares or a cookie secret, for the main module.
+// The server is shut down when the test ends. Servers without a Logger log through t.Log, so that their
+// messages are only printed for failed tests or with -v.
+func NewWithServer(t testing.TB, srv *server.Server, mainModule *core.Module) *App {
+	t.Helper()
+	if srv.Logger == nil {
+		srv.Logger = logger.Logger{Output: testWriter{t}}
+	}
+	if err := srv.Prepare(mainModule); err != nil {
+		t.Fatalf("sprinttest: preparing the server: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return &App{Server: srv, t: t}
+}
+
+// Request returns a builder for a request with the given method and target, e.g., "/users/42?fields=name".
+func (app *App) Request(method core.HttpMethod, target string) *Request {
+	return &Request{app: app, method: string(method), target: target, header: make(core.Header)}
+}
+
+// Get returns a builder for a GET request.
+func (app *App) Get(target string) *Request {
+	return app.Request(core.GET, target)
+}
+
+// Post returns a builder for a POST request.
+func (app *App) Post(target string) *Request {
+	return app.Request(core.POST, target)
+}
+
+// Put returns a builder for a PUT request.
+func (app *App) Put(target string) *Request {
+	return app.Request(core.PUT, target)
+}
+
+// Patch returns a builder for a PATCH request.
+func (app *App) Patch(target string) *Request {
+	return app.Request(core.PATCH, target)
+}
+
+// Delete returns a builder for a DELETE request.
+func (app *App) Delete(target string) *Request {
+	return app.Request(core.DELETE, target)
+}
+
+// Request builds a request sent to an App.
+type Request struct {
+	app    *App
+	method string
+	target string
+	query  []string
+	header core.Header
+	body   []byte
+}
+
+// Header adds a header to the request.
+func (request *Request) Header(key, value string) *Request {
+	request.header.Add(key, value)
+	return request
+}
+
+// Query adds a query parameter to the request, escaping its key and value.
+func (request *Request) Query(key, value string) *Request {
+	request.query = append(request.query, url.QueryEscape(key)+"="+url.QueryEscape(value))
+	return request
+}
+
+// Cookie adds a cookie to the request.
+func (request *Request) Cookie(name, value string) *Request {
+	return request.Header("Cookie", name+"="+value)
+}
+
+// Body sets the body of the request and its Content-Type.
+func (request *Request) Body(contentType core.ContentType, body []byte) *Request {
+	request.header.Set("Content-Type", string(contentType))
+	request.body = body
+	return request
+}
+
+// Text sets a plain text body.
+func (request *Request) Text(body string) *Request {
+	return request.Body(core.PLAINTEXT, []byte(body))
+}
+
+// JSON sets a JSON body encoded from value.
+func (request *Request) JSON(value interface{}) *Request {
+	request.app.t.Helper()
+	body, err := json.Marshal(value)
+	if err != nil {
+		request.app.t.Fatalf("sprinttest: encoding the JSON body: %v", err)
+	}
+	return request.Body(core.JSON, body)
+}
+
+// Do sends the request and reads the whole response. It fails the test if the request cannot be served.
+func (request *Request) Do() *Response {
+	t := request.app.t
+	t.Helper()
+	target := request.target
+	if len(request.query) > 0 {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + strings.Join(request.query, "&")
+	}
+	httpRequest, err := http.NewRequest(request.method, target, bytes.NewReader(request.body))
+	if err != nil {
+		t.Fatalf("sprinttest: building %s %s: %v", request.method, target, err)
+	}
+	httpRequest.Host = "sprinttest"
+	httpRequest.Header = http.Header(request.header.Clone())
+	httpRequest.Close = true
+
+	timeout := request.app.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	client, conn := net.Pipe()
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(timeout))
+	go request.app.Server.ServeConn(conn)
+
+	// The pipe is synchronous: the request is written while the response is read.
+	writeErr := make(chan error, 1)
+	go func() { writeErr <- httpRequest.Write(client) }()
+	httpResponse, err := http.ReadResponse(bufio.NewReader(client), httpRequest)
+	if err != nil {
+		t.Fatalf("sprinttest: %s %s: reading the response: %v", request.method, target, err)
+	}
+	defer httpResponse.Body.Close()
+	body, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		t.Fatalf("sprinttest: %s %s: reading the response body: %v", request.method, target, err)
+	}
+	if err := <-writeErr; err != nil {
+		t.Fatalf("sprinttest: %s %s: writing the request: %v", request.method, target, err)
+	}
+	return &Response{
+		StatusCode: httpResponse.StatusCode,
+		Headers:    core.Header(httpResponse.Header),
+		Body:       body,
+		t:          t,
+		name:       request.method + " " + target,
+	}
+}
+
+// Response is a response received from an App, with assertion helpers.
+// Failed assertions mark the test as failed and let it continue.
+type Response struct {
+	StatusCode int         // Status code of the response.
+	Headers    core.Header // Headers of the response.
+	Body       []byte      // Whole body of the response, de-chunked.
+
+	t    testing.TB
+	name string // Method and target of the request, used in failure messages.
+}
+
+// Text returns the body as a string.
+func (response *Response) Text() string {
+	return string(response.Body)
+}
+
+// DecodeJSON decodes the JSON body into value. It fails the test if the body is not valid JSON.
+func (response *Response) DecodeJSON(value interface{}) *Response {
+	response.t.Helper()
+	if err := json.Unmarshal(response.Body, value); err != nil {
+		response.t.Fatalf("%s: decoding the JSON body %q: %v", response.name, response.Body, err)
+	}
+	return response
+}
+
+// ExpectStatus asserts the status code of the response.
+func (response *Response) ExpectStatus(statusCode int) *Response {
+	response.t.Helper()
+	if response.StatusCode != statusCode {
+		response.t.Errorf("%s: status code is %d, want %d", response.name, response.StatusCode, statusCode)
+	}
+	return response
+}
+
+// ExpectHeader asserts the first value of a header. Values of Content-Type match with or without parameters,
+// e.g., "application/json" matches "application/json; charset=utf-8".
+func (response *Response) ExpectHeader(key, value string) *Response {
+	response.t.Helper()
+	actual := response.Headers.Get(key)
+	if !response.Headers.Has(key) {
+		response.t.Errorf("%s: header %s is missing, want %q", response.name, key, value)
+	} else if actual != value && !(core.CanonicalHeaderKey(key) == "Content-Type" && strings.HasPrefix(actual, value+";")) {
+		response.t.Errorf("%s: header %s is %q, want %q", response.name, key, actual, value)
+	}
+	return response
+}
+
+// ExpectNoHeader asserts that a header is absent.
+func (response *Response) ExpectNoHeader(key string) *Response {
+	response.t.Helper()
+	if response.Headers.Has(key) {
+		response.t.Errorf("%s: header %s is %q, want none", response.name, key, response.Headers.Get(key))
+	}
+	return response
+}
+
+// ExpectBody asserts the whole body.
+func (response *Response) ExpectBody(body string) *Response {
+	response.t.Helper()
+	if string(response.Body) != body {
+		response.t.Errorf("%s: body is %q, want %q", response.name, response.Body, body)
+	}
+	return response
+}
+
+// ExpectBodyContains asserts that the body contains a substring.
+func (response *Response) ExpectBodyContains(substring string) *Response {
+	response.t.Helper()
+	if !strings.Contains(string(response.Body), substring) {
+		response.t.Errorf("%s: body %q does not contain %q", response.name, response.Body, substring)
+	}
+	return response
+}
+
+// ExpectJSON asserts that the body is the JSON encoding of expected. Both are compared once decoded,
+// so formatting and the order of object keys do not matter.
+func (response *Response) ExpectJSON(expected interface{}) *Response {
+	response.t.Helper()
+	var actual interface{}
+	if err := json.Unmarshal(response.Body, &actual); err != nil {
+		response.t.Errorf("%s: body %q is not JSON: %v", response.name, response.Body, err)
+		return response
+	}
+	encoded, err := json.Marshal(expected)
+	if err != nil {
+		response.t.Fatalf("%s: encoding the expected JSON: %v", response.name, err)
+	}
+	var want interface{}
+	json.Unmarshal(encoded, &want)
+	if !reflect.DeepEqual(actual, want) {
+		response.t.Errorf("%s: JSON body is %s, want %s", response.name, response.Body, encoded)
+	}
+	return response
+}
+
+// testWriter writes log lines with t.Log.
+type testWriter struct {
+	t testing.TB
+}
+
+// Write logs p without its trailing newline.
+func (writer testWriter) Write(p []byte) (int, error) {
+	writer.t.Log(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,182 @@
+package sprinttest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+	"github.com/zlorgoncho1/sprint/server"
+	"github.com/zlorgoncho1/sprint/sprinttest"
+)
+
+// usersModule returns a module with a users controller exercising parameters, queries and bodies.
+func usersModule() *core.Module {
+	users := &core.Controller{Name: "Users", Path: "users"}
+	users.AddRoute(core.GET, ":id", func(request core.Request) core.Response {
+		return core.Response{Content: map[string]string{"id": request.Params["id"]}, ContentType: core.JSON}
+	})
+	users.AddRoute(core.GET, ":id/posts/:post", func(request core.Request) core.Response {
+		return core.Response{Content: request.Params["id"] + "/" + request.Params["post"] + "?" + strings.Join(request.Query, "&"), ContentType: core.PLAINTEXT}
+	})
+	users.AddRoute(core.POST, "", func(request core.Request) core.Response {
+		return core.Response{Content: request.Body, ContentType: core.JSON, StatusCode: 201, StatusText: "Created"}
+	})
+	users.AddRoute(core.DELETE, ":id", func(request core.Request) core.Response {
+		return core.Response{Content: "deleted " + request.Params["id"], ContentType: core.PLAINTEXT}
+	})
+	return &core.Module{Name: "UsersModule", Controllers: []*core.Controller{users}}
+}
+
+func TestRouter(t *testing.T) {
+	t.Parallel()
+	app := sprinttest.New(t, usersModule())
+
+	app.Get("/users/42").Do().
+		ExpectStatus(200).
+		ExpectHeader("Content-Type", "application/json").
+		ExpectJSON(map[string]string{"id": "42"})
+	app.Get("/users/42/posts/7").Query("sort", "new est").Do().
+		ExpectStatus(200).
+		ExpectBody("42/7?sort=new+est")
+	app.Post("/users").JSON(map[string]interface{}{"name": "Ada"}).Do().
+		ExpectStatus(201).
+		ExpectJSON(map[string]interface{}{"name": "Ada"})
+	app.Delete("/users/42").Do().ExpectStatus(200).ExpectBody("deleted 42")
+}
+
+func TestUnmatched(t *testing.T) {
+	t.Parallel()
+	app := sprinttest.New(t, usersModule())
+
+	app.Get("/missing").Do().ExpectStatus(404).ExpectBody("Not Found")
+	app.Get("/users/42/posts").Do().ExpectStatus(404)
+	app.Request(core.PUT, "/users/42").Do().
+		ExpectStatus(405).
+		ExpectHeader("Allow", "DELETE, GET").
+		ExpectBody("Method Not Allowed")
+	app.Delete("/users").Do().ExpectStatus(405).ExpectHeader("Allow", "POST")
+}
+
+func TestHead(t *testing.T) {
+	t.Parallel()
+	users := &core.Controller{Name: "Users", Path: "users"}
+	users.AddRoute(core.HEAD, ":id", func(request core.Request) core.Response {
+		return core.Response{Content: map[string]string{"id": request.Params["id"]}, ContentType: core.JSON}
+	})
+	app := sprinttest.New(t, &core.Module{Controllers: []*core.Controller{users}})
+
+	app.Request(core.HEAD, "/users/42").Do().
+		ExpectStatus(200).
+		ExpectHeader("Content-Type", "application/json").
+		ExpectHeader("Content-Length", "11").
+		ExpectBody("")
+}
+
+func TestMiddlewares(t *testing.T) {
+	t.Parallel()
+	tag := func(name string) core.Middleware {
+		return func(next core.Handler) core.Handler {
+			return func(request core.Request) core.Response {
+				response := next(request)
+				response.Header().Add("X-Chain", name)
+				return response
+			}
+		}
+	}
+	requireToken := func(next core.Handler) core.Handler {
+		return func(request core.Request) core.Response {
+			if request.Headers.Get("Authorization") != "Bearer token" {
+				return core.Response{Content: "Unauthorized", ContentType: core.PLAINTEXT, StatusCode: 401, StatusText: "Unauthorized"}
+			}
+			return next(request)
+		}
+	}
+
+	admin := &core.Controller{Name: "Admin", Path: "admin"}
+	admin.Use(requireToken, tag("controller"))
+	admin.AddRoute(core.GET, "stats", func(request core.Request) core.Response {
+		return core.Response{Content: "stats", ContentType: core.PLAINTEXT}
+	})
+	srv := &server.Server{}
+	srv.Use(tag("server"))
+	app := sprinttest.NewWithServer(t, srv, &core.Module{Controllers: []*core.Controller{admin}})
+
+	response := app.Get("/admin/stats").Header("Authorization", "Bearer token").Do().
+		ExpectStatus(200).
+		ExpectBody("stats")
+	// Server middlewares wrap the controller ones, so they see the response last.
+	if chain := strings.Join(response.Headers.Values("X-Chain"), ","); chain != "controller,server" {
+		t.Errorf("X-Chain is %q, want controller,server", chain)
+	}
+	app.Get("/admin/stats").Do().
+		ExpectStatus(401).
+		ExpectBody("Unauthorized")
+}
+
+func TestErrorPaths(t *testing.T) {
+	t.Parallel()
+	failing := &core.Controller{Name: "Failing", Path: "failing"}
+	failing.AddRoute(core.GET, "panic", func(request core.Request) core.Response {
+		panic("boom")
+	})
+	failing.AddRoute(core.GET, "slow", func(request core.Request) core.Response {
+		select {
+		case <-request.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return core.Response{Content: "too late"}
+	}).Timeout = 20 * time.Millisecond
+	failing.AddRoute(core.POST, "upload", func(request core.Request) core.Response {
+		return core.Response{Content: fmt.Sprintf("%d bytes", len(request.RawBody)), ContentType: core.PLAINTEXT}
+	})
+	app := sprinttest.NewWithServer(t, &server.Server{MaxBodyBytes: 8, MaxHeaderBytes: 1024}, &core.Module{Controllers: []*core.Controller{failing}})
+
+	app.Get("/failing/panic").Do().ExpectStatus(500).ExpectBody("Internal Server Error")
+	app.Get("/failing/slow").Do().ExpectStatus(503)
+	app.Post("/failing/upload").Text("12345678").Do().ExpectStatus(200).ExpectBody("8 bytes")
+	app.Post("/failing/upload").Text("123456789").Do().ExpectStatus(413)
+	app.Get("/failing/panic").Header("X-Large", strings.Repeat("x", 2048)).Do().ExpectStatus(431)
+}
+
+// recorder is a testing.TB recording failures instead of reporting them.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (recorder *recorder) Helper() {}
+
+func (recorder *recorder) Errorf(format string, args ...interface{}) {
+	recorder.errors = append(recorder.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFailedAssertions(t *testing.T) {
+	t.Parallel()
+	recorded := &recorder{TB: t}
+	response := sprinttest.New(recorded, usersModule()).Get("/users/42").Do()
+
+	tests := []struct {
+		name   string
+		assert func()
+		fails  bool
+	}{
+		{"status", func() { response.ExpectStatus(404) }, true},
+		{"header", func() { response.ExpectHeader("Content-Type", "text/plain") }, true},
+		{"header with parameters", func() { response.ExpectHeader("Content-Type", "application/json") }, false},
+		{"missing header", func() { response.ExpectHeader("X-Missing", "") }, true},
+		{"absent header", func() { response.ExpectNoHeader("Content-Type") }, true},
+		{"body", func() { response.ExpectBody("{}") }, true},
+		{"body substring", func() { response.ExpectBodyContains(`"id"`) }, false},
+		{"JSON", func() { response.ExpectJSON(map[string]string{"id": "43"}) }, true},
+		{"JSON key order", func() { response.ExpectJSON(map[string]interface{}{"id": "42"}) }, false},
+	}
+	for _, test := range tests {
+		recorded.errors = nil
+		test.assert()
+		if failed := len(recorded.errors) > 0; failed != test.fails {
+			t.Errorf("%s: failed = %v %q, want %v", test.name, failed, recorded.errors, test.fails)
+		}
+	}
+}
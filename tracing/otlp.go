@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// scopeName is the instrumentation scope of the exported spans.
+const scopeName = "github.com/zlorgoncho1/sprint/tracing"
+
+// OTLPExporter writes spans in the JSON encoding of the OpenTelemetry protocol, one ExportTraceServiceRequest
+// per line, as read by the file receiver of the OpenTelemetry Collector. It is meant for local testing,
+// e.g., NewOTLPExporter(os.Stdout).
+type OTLPExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closed bool
+}
+
+// NewOTLPExporter returns an exporter writing to w. Shutdown closes w if it is an io.Closer,
+// unless it is os.Stdout or os.Stderr.
+func NewOTLPExporter(w io.Writer) *OTLPExporter {
+	return &OTLPExporter{writer: w}
+}
+
+// NewOTLPFileExporter returns an exporter appending to the named file, created if needed.
+func NewOTLPFileExporter(filename string) (*OTLPExporter, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewOTLPExporter(file), nil
+}
+
+// ExportSpans writes the spans as a single line. Spans exported after Shutdown are dropped.
+func (exporter *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	if exporter.closed {
+		return nil
+	}
+	_, err = exporter.writer.Write(append(line, '\n'))
+	return err
+}
+
+// Shutdown stops the exporter and closes its writer.
+func (exporter *OTLPExporter) Shutdown(ctx context.Context) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	if exporter.closed {
+		return nil
+	}
+	exporter.closed = true
+	if file, ok := exporter.writer.(*os.File); ok && (file == os.Stdout || file == os.Stderr) {
+		return nil
+	}
+	if closer, ok := exporter.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// otlpKeyValue, otlpSpan and the types below follow the JSON mapping of the OTLP protobuf messages:
+// IDs are hexadecimal strings and 64-bit integers are decimal strings.
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Flags             uint32         `json:"flags"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope map[string]string `json:"scope"`
+	Spans []otlpSpan        `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   map[string][]otlpKeyValue `json:"resource"`
+	ScopeSpans []otlpScopeSpans          `json:"scopeSpans"`
+}
+
+// otlpRequest converts spans into an ExportTraceServiceRequest, grouped by service.
+func otlpRequest(spans []SpanData) map[string][]otlpResourceSpans {
+	var resourceSpans []otlpResourceSpans
+	services := make(map[string]int)
+	for _, span := range spans {
+		index, ok := services[span.ServiceName]
+		if !ok {
+			index = len(resourceSpans)
+			services[span.ServiceName] = index
+			resource := map[string][]otlpKeyValue{"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName(span.ServiceName)})}
+			resourceSpans = append(resourceSpans, otlpResourceSpans{Resource: resource, ScopeSpans: []otlpScopeSpans{{Scope: map[string]string{"name": scopeName}}}})
+		}
+		scopeSpans := &resourceSpans[index].ScopeSpans[0]
+		scopeSpans.Spans = append(scopeSpans.Spans, otlpSpanOf(span))
+	}
+	return map[string][]otlpResourceSpans{"resourceSpans": resourceSpans}
+}
+
+// serviceName returns the name of the service, "unknown_service" as in OpenTelemetry when it is not set.
+func serviceName(name string) string {
+	if name == "" {
+		return "unknown_service"
+	}
+	return name
+}
+
+// otlpSpanOf converts a span.
+func otlpSpanOf(span SpanData) otlpSpan {
+	converted := otlpSpan{
+		TraceID:           span.SpanContext.TraceID.String(),
+		SpanID:            span.SpanContext.SpanID.String(),
+		TraceState:        span.SpanContext.TraceState,
+		Flags:             uint32(span.SpanContext.Flags),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: unixNano(span.StartTime),
+		EndTimeUnixNano:   unixNano(span.EndTime),
+		Attributes:        otlpAttributes(span.Attributes),
+		Status:            otlpStatus{Code: span.StatusCode, Message: span.StatusMessage},
+	}
+	if span.Parent.IsValid() {
+		converted.ParentSpanID = span.Parent.SpanID.String()
+	}
+	for _, event := range span.Events {
+		converted.Events = append(converted.Events, otlpEvent{TimeUnixNano: unixNano(event.Time), Name: event.Name, Attributes: otlpAttributes(event.Attributes)})
+	}
+	return converted
+}
+
+// unixNano formats a time as a decimal number of nanoseconds since the Unix epoch.
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpAttributes converts attributes, sorted by key. Values of unsupported types are formatted as strings.
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	converted := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		converted = append(converted, otlpKeyValue{Key: key, Value: otlpValue(attributes[key])})
+	}
+	return converted
+}
+
+// otlpValue converts a value into an AnyValue.
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int32:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case uint:
+		return map[string]interface{}{"intValue": strconv.FormatUint(uint64(v), 10)}
+	case uint32:
+		return map[string]interface{}{"intValue": strconv.FormatUint(uint64(v), 10)}
+	case uint64:
+		return map[string]interface{}{"intValue": strconv.FormatUint(v, 10)}
+	case float32:
+		return otlpValue(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return map[string]interface{}{"stringValue": strconv.FormatFloat(v, 'g', -1, 64)}
+		}
+		return map[string]interface{}{"doubleValue": v}
+	case fmt.Stringer:
+		return map[string]interface{}{"stringValue": v.String()}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	parent := SpanContext{TraceID: TraceID{0x4b, 0xf9, 15: 0x36}, SpanID: SpanID{0x00, 0xf0, 7: 0xb7}, Flags: FlagSampled}
+	startTime := time.Unix(1700000000, 123456789)
+	spans := []SpanData{
+		{
+			Name:          "GET /users/:id",
+			SpanContext:   SpanContext{TraceID: parent.TraceID, SpanID: SpanID{1, 2, 3, 4, 5, 6, 7, 8}, Flags: FlagSampled, TraceState: "rojo=1"},
+			Parent:        parent,
+			Kind:          KindServer,
+			StartTime:     startTime,
+			EndTime:       startTime.Add(1500 * time.Millisecond),
+			Attributes:    map[string]interface{}{"http.route": "/users/:id", "http.response.status_code": 500, "retry": false, "ratio": 0.5, "nan": math.NaN()},
+			Events:        []Event{{Name: "exception", Time: startTime.Add(time.Millisecond), Attributes: map[string]interface{}{"exception.message": "boom"}}},
+			StatusCode:    StatusError,
+			StatusMessage: "Internal Server Error",
+			ServiceName:   "users-api",
+		},
+		{
+			Name:        "root",
+			SpanContext: SpanContext{TraceID: TraceID{15: 1}, SpanID: SpanID{7: 1}},
+			Kind:        KindInternal,
+			StartTime:   time.Unix(0, 1),
+			EndTime:     time.Unix(0, 2),
+		},
+	}
+	var output bytes.Buffer
+	exporter := NewOTLPExporter(&output)
+	if err := exporter.ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"resourceSpans":[
+		{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"users-api"}}]},
+		 "scopeSpans":[{"scope":{"name":"github.com/zlorgoncho1/sprint/tracing"},"spans":[{
+			"traceId":"4bf90000000000000000000000000036",
+			"spanId":"0102030405060708",
+			"traceState":"rojo=1",
+			"parentSpanId":"00f00000000000b7",
+			"flags":1,
+			"name":"GET /users/:id",
+			"kind":2,
+			"startTimeUnixNano":"1700000000123456789",
+			"endTimeUnixNano":"1700000001623456789",
+			"attributes":[
+				{"key":"http.response.status_code","value":{"intValue":"500"}},
+				{"key":"http.route","value":{"stringValue":"/users/:id"}},
+				{"key":"nan","value":{"stringValue":"NaN"}},
+				{"key":"ratio","value":{"doubleValue":0.5}},
+				{"key":"retry","value":{"boolValue":false}}
+			],
+			"events":[{"timeUnixNano":"1700000000124456789","name":"exception","attributes":[{"key":"exception.message","value":{"stringValue":"boom"}}]}],
+			"status":{"code":2,"message":"Internal Server Error"}
+		 }]}]},
+		{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"unknown_service"}}]},
+		 "scopeSpans":[{"scope":{"name":"github.com/zlorgoncho1/sprint/tracing"},"spans":[{
+			"traceId":"00000000000000000000000000000001",
+			"spanId":"0000000000000001",
+			"flags":0,
+			"name":"root",
+			"kind":1,
+			"startTimeUnixNano":"1",
+			"endTimeUnixNano":"2",
+			"status":{}
+		 }]}]}
+	]}`
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, []byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	if got := output.String(); got != compacted.String()+"\n" {
+		t.Errorf("exported\n%s\nwant\n%s", got, compacted.String())
+	}
+
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	output.Reset()
+	if err := exporter.ExportSpans(context.Background(), spans); err != nil || output.Len() != 0 {
+		t.Errorf("ExportSpans after Shutdown wrote %q, %v", output.String(), err)
+	}
+}
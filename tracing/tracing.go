@@ -0,0 +1,362 @@
+// Package tracing creates spans for the requests of a server and propagates W3C Trace Context
+// (https://www.w3.org/TR/trace-context/) through the traceparent and tracestate headers.
+//
+// A server with a Tracer starts a server span per request, continuing the trace of the client when the request
+// carries a valid traceparent header. Handlers reach the span, add attributes and start child spans:
+//
+//	func getUser(request core.Request) core.Response {
+//		request, span := tracing.StartSpan(request, "load user")
+//		defer span.End()
+//		span.SetAttribute("user.id", request.Params["id"])
+//		...
+//	}
+//
+// Ended spans are sent to the Exporter of the Tracer, e.g., an OTLPExporter writing OTLP/JSON to a file.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+// Names of the W3C Trace Context headers.
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the ID as 32 lowercase hexadecimal digits.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID is not all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the ID as 16 lowercase hexadecimal digits.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID is not all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// FlagSampled is the trace flag telling that the trace is recorded.
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span propagated to other services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte   // Trace flags, e.g., FlagSampled.
+	TraceState string // Vendor-specific data of the tracestate header, propagated as is.
+	Remote     bool   // Whether the context was received from another service.
+}
+
+// IsValid reports whether the trace and span IDs are set.
+func (spanContext SpanContext) IsValid() bool {
+	return spanContext.TraceID.IsValid() && spanContext.SpanID.IsValid()
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (spanContext SpanContext) IsSampled() bool {
+	return spanContext.Flags&FlagSampled != 0
+}
+
+// Traceparent returns the value of the traceparent header of the context, e.g.,
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func (spanContext SpanContext) Traceparent() string {
+	return "00-" + spanContext.TraceID.String() + "-" + spanContext.SpanID.String() + "-" + hex.EncodeToString([]byte{spanContext.Flags})
+}
+
+// errInvalidTraceparent is returned for traceparent headers that do not follow the W3C format.
+var errInvalidTraceparent = errors.New("tracing: invalid traceparent header")
+
+// ParseTraceparent parses the value of a traceparent header. Future versions of the format are accepted
+// as long as they start with the fields of version 00.
+func ParseTraceparent(value string) (SpanContext, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' || (len(value) > 55 && value[55] != '-') {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	version, err := decodeHex(value[0:2], 1)
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	var spanContext SpanContext
+	traceID, err := decodeHex(value[3:35], 16)
+	if err != nil {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	spanID, err := decodeHex(value[36:52], 8)
+	if err != nil {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	flags, err := decodeHex(value[53:55], 1)
+	if err != nil {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	copy(spanContext.TraceID[:], traceID)
+	copy(spanContext.SpanID[:], spanID)
+	spanContext.Flags = flags[0]
+	if !spanContext.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	spanContext.Remote = true
+	return spanContext, nil
+}
+
+// decodeHex decodes a lowercase hexadecimal string of the given number of bytes.
+func decodeHex(value string, size int) ([]byte, error) {
+	if len(value) != 2*size || strings.ToLower(value) != value {
+		return nil, errInvalidTraceparent
+	}
+	return hex.DecodeString(value)
+}
+
+// Extract returns the span context carried by the traceparent and tracestate headers, if valid.
+func Extract(headers core.Header) (SpanContext, bool) {
+	spanContext, err := ParseTraceparent(headers.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	spanContext.TraceState = strings.Join(headers.Values(TracestateHeader), ",")
+	return spanContext, true
+}
+
+// Inject sets the traceparent and tracestate headers of an outgoing request from the span context,
+// e.g., with core.Header(httpRequest.Header).
+func Inject(headers core.Header, spanContext SpanContext) {
+	if !spanContext.IsValid() {
+		return
+	}
+	headers.Set(TraceparentHeader, spanContext.Traceparent())
+	if spanContext.TraceState != "" {
+		headers.Set(TracestateHeader, spanContext.TraceState)
+	} else {
+		headers.Del(TracestateHeader)
+	}
+}
+
+// SpanKind is the role of a span in a trace, with the values of OpenTelemetry.
+type SpanKind int
+
+// Enumeration of SpanKind.
+const (
+	KindInternal SpanKind = 1 // Internal operation of a service.
+	KindServer   SpanKind = 2 // Handling of a request received by a server.
+	KindClient   SpanKind = 3 // Request sent to another service.
+)
+
+// StatusCode is the outcome of a span, with the values of OpenTelemetry.
+type StatusCode int
+
+// Enumeration of StatusCode.
+const (
+	StatusUnset StatusCode = 0 // The outcome is not known, the default.
+	StatusOK    StatusCode = 1 // The operation succeeded, as set explicitly.
+	StatusError StatusCode = 2 // The operation failed.
+)
+
+// Event is a timestamped annotation of a span, e.g., the end of a phase.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// SpanData is a snapshot of an ended span, given to exporters.
+type SpanData struct {
+	Name          string
+	SpanContext   SpanContext
+	Parent        SpanContext // Context of the parent span, invalid for root spans.
+	Kind          SpanKind
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{} // Values are strings, booleans, integers or floats.
+	Events        []Event
+	StatusCode    StatusCode
+	StatusMessage string
+	ServiceName   string // ServiceName of the Tracer.
+}
+
+// Exporter sends ended spans to a tracing backend. ExportSpans is called once per ended span,
+// from the goroutine that ends it, and must be safe for concurrent use.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer starts spans and exports them once ended.
+type Tracer struct {
+	Exporter    Exporter // Destination of the ended spans; spans are not exported when nil.
+	ServiceName string   // Name of the service in exported spans, e.g., "users-api".
+	// SampleRatio is the fraction of new traces recorded, between 0 and 1; every trace is recorded when zero.
+	// Traces continued from a client keep the sampling decision of the client.
+	SampleRatio float64
+}
+
+// Start starts a span, child of parent when it is valid, or the root of a new trace.
+func (tracer *Tracer) Start(parent SpanContext, name string, kind SpanKind, startTime time.Time) *Span {
+	if startTime.IsZero() {
+		startTime = time.Now()
+	}
+	spanContext := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		spanContext.TraceID, spanContext.Flags, spanContext.TraceState = parent.TraceID, parent.Flags, parent.TraceState
+	} else {
+		spanContext.TraceID = newTraceID()
+		if tracer.sampled(spanContext.TraceID) {
+			spanContext.Flags = FlagSampled
+		}
+	}
+	return &Span{tracer: tracer, data: SpanData{Name: name, SpanContext: spanContext, Parent: parent, Kind: kind, StartTime: startTime, ServiceName: tracer.ServiceName, Attributes: make(map[string]interface{})}}
+}
+
+// Shutdown shuts down the exporter, flushing the spans it buffers.
+func (tracer *Tracer) Shutdown(ctx context.Context) error {
+	if tracer.Exporter == nil {
+		return nil
+	}
+	return tracer.Exporter.Shutdown(ctx)
+}
+
+// sampled decides whether a new trace is recorded, from its ID so that the decision is consistent.
+func (tracer *Tracer) sampled(traceID TraceID) bool {
+	if tracer.SampleRatio <= 0 || tracer.SampleRatio >= 1 {
+		return true
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/(1<<53) < tracer.SampleRatio
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// Span is an operation of a trace. Its methods are safe for concurrent use, and do nothing on a nil Span,
+// which is returned for requests without tracing.
+type Span struct {
+	tracer *Tracer
+	mutex  sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext returns the context of the span, to propagate to other services with Inject.
+func (span *Span) SpanContext() SpanContext {
+	if span == nil {
+		return SpanContext{}
+	}
+	return span.data.SpanContext
+}
+
+// SetName replaces the name of the span, e.g., once the route of a request is known.
+func (span *Span) SetName(name string) {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.data.Name = name
+}
+
+// SetAttribute sets an attribute of the span. Values should be strings, booleans, integers or floats.
+func (span *Span) SetAttribute(key string, value interface{}) {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.data.Attributes[key] = value
+}
+
+// AddEvent adds an event to the span, at the current time.
+func (span *Span) AddEvent(name string, attributes map[string]interface{}) {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.data.Events = append(span.data.Events, Event{Name: name, Time: time.Now(), Attributes: attributes})
+}
+
+// SetStatus sets the outcome of the span.
+func (span *Span) SetStatus(code StatusCode, message string) {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.data.StatusCode, span.data.StatusMessage = code, message
+}
+
+// End ends the span and exports it when it is sampled. Later calls do nothing.
+func (span *Span) End() {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	if span.ended {
+		span.mutex.Unlock()
+		return
+	}
+	span.ended = true
+	span.data.EndTime = time.Now()
+	data := span.data
+	span.mutex.Unlock()
+	if span.tracer.Exporter != nil && data.SpanContext.IsSampled() {
+		span.tracer.Exporter.ExportSpans(context.Background(), []SpanData{data})
+	}
+}
+
+// SpanKey holds the current span of a request. The server sets it to the server span of the request.
+var SpanKey = core.NewKey[*Span]("span")
+
+// FromRequest returns the current span of the request, nil when the request is not traced.
+func FromRequest(request core.Request) *Span {
+	span, _ := SpanKey.Get(request)
+	return span
+}
+
+// StartSpan starts a child of the current span of the request, and returns the request carrying it as current span.
+// It returns a nil Span, whose methods do nothing, when the request is not traced.
+func StartSpan(request core.Request, name string) (core.Request, *Span) {
+	parent := FromRequest(request)
+	if parent == nil {
+		return request, nil
+	}
+	span := parent.tracer.Start(parent.SpanContext(), name, KindInternal, time.Time{})
+	return SpanKey.Set(request, span), span
+}
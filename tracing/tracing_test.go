@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zlorgoncho1/sprint/core"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name    string
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", true, false},
+		{"unknown flags", "00-" + traceID + "-" + spanID + "-09", true, true},
+		{"surrounding spaces", " 00-" + traceID + "-" + spanID + "-01\t", true, true},
+		{"future version", "01-" + traceID + "-" + spanID + "-01", true, true},
+		{"future version with extra fields", "cc-" + traceID + "-" + spanID + "-01-what-the-future-will-be-like", true, true},
+		{"future version with extra characters", "cc-" + traceID + "-" + spanID + "-01what", false, false},
+		{"version 00 with extra fields", "00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"uppercase version", "0A-" + traceID + "-" + spanID + "-01", false, false},
+		{"uppercase trace ID", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01", false, false},
+		{"uppercase span ID", "00-" + traceID + "-00F067AA0BA902B7-01", false, false},
+		{"uppercase flags", "00-" + traceID + "-" + spanID + "-0A", false, false},
+		{"all-zero trace ID", "00-00000000000000000000000000000000-" + spanID + "-01", false, false},
+		{"all-zero span ID", "00-" + traceID + "-0000000000000000-01", false, false},
+		{"short trace ID", "00-" + traceID[1:] + "-" + spanID + "-01", false, false},
+		{"long trace ID", "00-" + traceID + "0-" + spanID + "-01", false, false},
+		{"short span ID", "00-" + traceID + "-" + spanID[1:] + "-01", false, false},
+		{"short flags", "00-" + traceID + "-" + spanID + "-1", false, false},
+		{"short version", "0-" + traceID + "-" + spanID + "-01", false, false},
+		{"non-hexadecimal trace ID", "00-" + traceID[:31] + "g-" + spanID + "-01", false, false},
+		{"wrong separators", "00_" + traceID + "_" + spanID + "_01", false, false},
+		{"empty", "", false, false},
+	}
+	for _, test := range tests {
+		spanContext, err := ParseTraceparent(test.value)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: ParseTraceparent(%q) error = %v, want valid %v", test.name, test.value, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			if spanContext != (SpanContext{}) {
+				t.Errorf("%s: invalid header returned %+v", test.name, spanContext)
+			}
+			continue
+		}
+		if spanContext.TraceID.String() != traceID || spanContext.SpanID.String() != spanID || !spanContext.Remote {
+			t.Errorf("%s: parsed %+v", test.name, spanContext)
+		}
+		if spanContext.IsSampled() != test.sampled {
+			t.Errorf("%s: sampled = %v, want %v", test.name, spanContext.IsSampled(), test.sampled)
+		}
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	headers := core.Header{}
+	headers.Add("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	headers.Add("tracestate", "congo=t61rcWkgMzE")
+	headers.Add("tracestate", "rojo=00f067aa0ba902b7")
+	spanContext, ok := Extract(headers)
+	if !ok || spanContext.TraceState != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Fatalf("Extract returned %+v, %v", spanContext, ok)
+	}
+
+	child := (&Tracer{}).Start(spanContext, "child", KindServer, time.Time{}).SpanContext()
+	outgoing := core.Header{"Tracestate": {"stale"}}
+	Inject(outgoing, child)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + child.SpanID.String() + "-01"
+	if outgoing.Get("traceparent") != want || outgoing.Get("tracestate") != spanContext.TraceState {
+		t.Errorf("Inject set %v, want traceparent %q and the tracestate of the parent", outgoing, want)
+	}
+
+	if _, ok := Extract(core.Header{"Traceparent": {"00-invalid"}}); ok {
+		t.Error("Extract accepted an invalid traceparent")
+	}
+	outgoing = core.Header{}
+	Inject(outgoing, SpanContext{})
+	if len(outgoing) != 0 {
+		t.Errorf("Inject set %v for an invalid span context", outgoing)
+	}
+}
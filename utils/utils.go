@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -39,27 +41,75 @@ func DictToHTTPHeadersResponse(headers map[string]string) string {
 		// Each header is formatted as "Key: Value".
 		lines = append(lines, fmt.Sprintf("%s: %s", k, v))
 	}
-	// Join all headers with a new line, mimicking HTTP header format.
-	return strings.Join(lines, "\n")
+	// Join all headers with CRLF, as required by the HTTP header format.
+	return strings.Join(lines, "\r\n")
+}
+
+// HeaderToHTTPHeadersResponse formats headers as HTTP header lines, sorted by key.
+// A key holding several values produces one "Key: Value" line per value, as required for Set-Cookie.
+func HeaderToHTTPHeadersResponse(headers core.Header) string {
+	var lines []string
+	for _, k := range headers.Keys() {
+		for _, v := range headers[k] {
+			lines = append(lines, fmt.Sprintf("%s: %s", k, v))
+		}
+	}
+	// Join all headers with CRLF, as required by the HTTP header format.
+	return strings.Join(lines, "\r\n")
 }
 
 // GetDefaultHeader generates and returns common default HTTP headers.
 // It automatically calculates content length and sets the current date.
-func GetDefaultHeader(content string, contentType core.ContentType) map[string]string {
-	return map[string]string{
-		"Content-Type":   string(contentType),
-		"Content-Length": fmt.Sprintf("%d", len(content)),
-		"Connection":     "close",
-		"Date":           time.Now().Format(time.RFC1123Z),
+func GetDefaultHeader(content string, contentType core.ContentType) core.Header {
+	return core.Header{
+		"Content-Type":   {string(contentType)},
+		"Content-Length": {fmt.Sprintf("%d", len(content))},
+		"Connection":     {"close"},
+		"Date":           {time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")},
+	}
+}
+
+// GetDefaultStreamHeader returns the default HTTP headers of a streamed response,
+// whose length is not known when the headers are sent.
+func GetDefaultStreamHeader(contentType core.ContentType) core.Header {
+	return core.Header{
+		"Content-Type": {string(contentType)},
+		"Connection":   {"close"},
+		"Date":         {time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")},
+	}
+}
+
+// MergeHeaders combines several headers into a new one. A key present in a later header
+// replaces all the values of that key from the earlier ones. Nil headers are skipped.
+func MergeHeaders(headers ...core.Header) core.Header {
+	merged := make(core.Header)
+	for _, header := range headers {
+		for key, values := range header {
+			merged[core.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+	}
+	return merged
+}
+
+// SecurityHeaders returns a conservative set of security headers, meant to be used as Server.DefaultHeaders.
+func SecurityHeaders() core.Header {
+	return core.Header{
+		"X-Content-Type-Options":     {"nosniff"},
+		"X-Frame-Options":            {"DENY"},
+		"Referrer-Policy":            {"strict-origin-when-cross-origin"},
+		"Cross-Origin-Opener-Policy": {"same-origin"},
 	}
 }
 
 // FormatHTTPResponse constructs a complete HTTP response message.
-// It combines the status line, headers, and content into a single byte slice.
+// It combines the status line, headers, and content into a single byte slice, using CRLF line endings.
 func FormatHTTPResponse(status, headers, content string) []byte {
 	var response strings.Builder
-	response.WriteString(status + "\n")
-	response.WriteString(headers + "\n\n")
+	response.WriteString(status + "\r\n")
+	if headers != "" {
+		response.WriteString(headers + "\r\n")
+	}
+	response.WriteString("\r\n")
 	response.WriteString(content)
 	return []byte(response.String())
 }
@@ -71,8 +121,13 @@ func HandleHTML(response *core.Response) {
 
 // HandleJSON sets the ContentType of the response to "application/json"
 // and converts the Content field of response to a JSON string.
+// Content that is already encoded, as a json.RawMessage, is sent as is.
 func HandleJSON(response *core.Response) {
 	response.ContentType = "application/json"
+	if raw, ok := response.Content.(json.RawMessage); ok {
+		response.Content = string(raw)
+		return
+	}
 	jsonBytes, err := json.Marshal(response.Content)
 	if err != nil {
 		// If JSON marshaling fails, it panics. This might be replaced by better error handling in a real-world application.
@@ -91,11 +146,11 @@ func HandlePlainText(response *core.Response) {
 func JoinPaths(paths ...string) string {
 	var buffer strings.Builder
 
-	for i, path := range paths {
+	for _, path := range paths {
 		// Trim slashes and then conditionally add one slash back.
 		trimmedPath := strings.Trim(path, "/")
 		if trimmedPath != "" {
-			if i > 0 {
+			if buffer.Len() > 0 {
 				buffer.WriteString("/")
 			}
 			buffer.WriteString(trimmedPath)
@@ -103,3 +158,27 @@ func JoinPaths(paths ...string) string {
 	}
 	return buffer.String()
 }
+
+// GenerateRequestID returns a random 128-bit identifier encoded as a 32 characters hexadecimal string.
+func GenerateRequestID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand only fails if the operating system has no entropy source left.
+		panic(err)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// IsValidRequestID reports whether a client provided request ID can be reused as is:
+// it must be non-empty, at most 128 characters long and only contain printable ASCII characters.
+func IsValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
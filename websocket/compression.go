@@ -0,0 +1,47 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+)
+
+// deflateTail is the empty stored block that ends every flushed deflate stream.
+// permessage-deflate removes it from compressed messages (RFC 7692, section 7.2.1).
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// compressMessage compresses a message payload for permessage-deflate.
+func compressMessage(payload []byte, level int) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), deflateTail), nil
+}
+
+// decompressMessage decompresses a permessage-deflate payload.
+// It fails with errMessageTooBig when the decompressed message exceeds limit bytes (no limit if limit <= 0).
+func decompressMessage(payload []byte, limit int64) ([]byte, error) {
+	reader := flate.NewReader(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail)))
+	defer reader.Close()
+	var source io.Reader = reader
+	if limit > 0 {
+		source = io.LimitReader(reader, limit+1)
+	}
+	decompressed, err := io.ReadAll(source)
+	// The stream has no final block, so reaching the end of the input is expected.
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if limit > 0 && int64(len(decompressed)) > limit {
+		return nil, errMessageTooBig
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,571 @@
+package websocket
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message, text or binary.
+type MessageType int
+
+// Enumeration of MessageType. The values match the opcodes of the first frame of a message.
+const (
+	TextMessage   MessageType = 1 // UTF-8 encoded text message.
+	BinaryMessage MessageType = 2 // Binary message.
+)
+
+// Frame opcodes (RFC 6455, section 5.2).
+const (
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xa
+)
+
+// Close codes (RFC 6455, section 7.4.1).
+const (
+	CloseNormalClosure           = 1000 // The purpose of the connection has been fulfilled.
+	CloseGoingAway               = 1001 // The server is going down or the browser navigated away.
+	CloseProtocolError           = 1002 // The peer violated the protocol.
+	CloseUnsupportedData         = 1003 // The peer sent a type of data that cannot be accepted.
+	CloseNoStatusReceived        = 1005 // The close frame had no status code. Never sent.
+	CloseAbnormalClosure         = 1006 // The connection was closed without a close frame. Never sent.
+	CloseInvalidFramePayloadData = 1007 // A text message or close reason was not valid UTF-8.
+	ClosePolicyViolation         = 1008 // A message violated the policy of the endpoint.
+	CloseMessageTooBig           = 1009 // A message exceeded the maximum message size.
+	CloseMandatoryExtension      = 1010 // The client required an extension the server did not negotiate.
+	CloseInternalServerErr       = 1011 // The server encountered an unexpected condition.
+)
+
+// DefaultMaxMessageSize is the maximum size of a received message when Options.MaxMessageSize is zero.
+const DefaultMaxMessageSize = 1 << 20
+
+// Options configures the WebSocket connections of a route.
+type Options struct {
+	Subprotocols         []string                       // Supported subprotocols, in order of preference.
+	CheckOrigin          func(origin, host string) bool // Accepts or rejects the Origin of a handshake, same-origin only when nil.
+	MaxMessageSize       int64                          // Maximum size of a received message, DefaultMaxMessageSize when zero, no limit when negative.
+	EnableCompression    bool                           // Negotiates permessage-deflate when the client offers it.
+	CompressionLevel     int                            // Level of compress/flate used for sent messages, flate.BestSpeed when zero.
+	CompressionThreshold int                            // Messages smaller than this number of bytes are sent uncompressed.
+	PingInterval         time.Duration                  // Interval of keep-alive pings, disabled when zero. The peer must answer within two intervals.
+	WriteTimeout         time.Duration                  // Maximum duration of each write, no limit when zero.
+}
+
+// CloseError is returned by read methods when the connection was closed by a close frame,
+// sent either by the peer or by this side after a protocol violation.
+type CloseError struct {
+	Code int    // Close code, e.g., CloseNormalClosure.
+	Text string // Close reason.
+}
+
+func (err *CloseError) Error() string {
+	if err.Text == "" {
+		return fmt.Sprintf("websocket: close %d", err.Code)
+	}
+	return fmt.Sprintf("websocket: close %d (%s)", err.Code, err.Text)
+}
+
+// ErrClosed is returned when writing to a connection after it has been closed.
+var ErrClosed = errors.New("websocket: connection closed")
+
+var errMessageTooBig = errors.New("message too big")
+
+// Conn is a server-side WebSocket connection.
+// It supports one concurrent reader and any number of concurrent writers.
+type Conn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	options     Options
+	subprotocol string
+	compression bool
+
+	writeMutex sync.Mutex
+	closeSent  bool // Whether a close frame was sent, guarded by writeMutex.
+
+	pongHandler func(data []byte)
+	readErr     error // Sticky error returned by read methods once the connection is closed.
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewConn creates a connection from an accepted handshake. The reader must be the buffered reader
+// the handshake was read from, if any, so that frames already received are not lost.
+func NewConn(conn net.Conn, reader *bufio.Reader, handshake Handshake, options Options) *Conn {
+	if reader == nil {
+		reader = bufio.NewReader(conn)
+	}
+	if options.MaxMessageSize == 0 {
+		options.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if options.CompressionLevel == 0 {
+		options.CompressionLevel = flate.BestSpeed
+	}
+	c := &Conn{
+		conn:        conn,
+		reader:      reader,
+		options:     options,
+		subprotocol: handshake.Subprotocol,
+		compression: handshake.Compression,
+		closed:      make(chan struct{}),
+	}
+	if options.PingInterval > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(2 * options.PingInterval))
+		go c.keepAlive()
+	}
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol, or "" if none was.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the network address of the client.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Done returns a channel closed once the underlying connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// SetReadDeadline sets the deadline of the next reads. It is overridden by keep-alive when PingInterval is set.
+func (c *Conn) SetReadDeadline(deadline time.Time) error {
+	return c.conn.SetReadDeadline(deadline)
+}
+
+// SetPongHandler sets the function called, from the reading goroutine, when a pong frame is received.
+func (c *Conn) SetPongHandler(handler func(data []byte)) {
+	c.pongHandler = handler
+}
+
+// ReadMessage reads the next data message, reassembling fragmented messages.
+// Pings are answered automatically. When the peer closes the connection, a *CloseError is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	messageType, payload, err := c.readMessage()
+	if err != nil {
+		c.readErr = c.handleReadError(err)
+		return 0, nil, c.readErr
+	}
+	return messageType, payload, nil
+}
+
+// ReadJSON reads the next message and decodes it as JSON into value.
+func (c *Conn) ReadJSON(value interface{}) error {
+	_, payload, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, value)
+}
+
+// WriteMessage sends a complete message in a single frame, compressed if negotiated.
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("websocket: invalid message type")
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.writeData(true, byte(messageType), data)
+}
+
+// WriteText sends a text message.
+func (c *Conn) WriteText(text string) error {
+	return c.WriteMessage(TextMessage, []byte(text))
+}
+
+// WriteJSON encodes value as JSON and sends it as a text message.
+func (c *Conn) WriteJSON(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// NextWriter returns a writer sending a message as a sequence of fragments, one per call to Write,
+// which allows sending large messages without holding them in memory. Other writes wait until the
+// returned writer is closed. With compression, the message is buffered and sent at Close instead.
+func (c *Conn) NextWriter(messageType MessageType) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, errors.New("websocket: invalid message type")
+	}
+	c.writeMutex.Lock()
+	return &messageWriter{conn: c, opcode: byte(messageType)}, nil
+}
+
+// Ping sends a ping frame. The data must not exceed 125 bytes.
+func (c *Conn) Ping(data []byte) error {
+	return c.writeControl(opPing, data)
+}
+
+// Close sends a close frame with the given code and reason, then closes the connection.
+func (c *Conn) Close(code int, reason string) error {
+	err := c.writeControl(opClose, closePayload(code, reason))
+	c.closeConn()
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// messageWriter is the writer returned by NextWriter.
+type messageWriter struct {
+	conn    *Conn
+	opcode  byte
+	buffer  []byte // Buffered message when compression is negotiated.
+	started bool
+	closed  bool
+}
+
+func (writer *messageWriter) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, ErrClosed
+	}
+	if writer.conn.compression {
+		writer.buffer = append(writer.buffer, p...)
+		return len(p), nil
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := writer.conn.writeFrame(false, false, writer.nextOpcode(), p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (writer *messageWriter) Close() error {
+	if writer.closed {
+		return nil
+	}
+	writer.closed = true
+	defer writer.conn.writeMutex.Unlock()
+	if writer.conn.compression {
+		return writer.conn.writeData(true, writer.opcode, writer.buffer)
+	}
+	return writer.conn.writeFrame(true, false, writer.nextOpcode(), nil)
+}
+
+// nextOpcode returns the opcode of the message for the first fragment, then the continuation opcode.
+func (writer *messageWriter) nextOpcode() byte {
+	if writer.started {
+		return opContinuation
+	}
+	writer.started = true
+	return writer.opcode
+}
+
+// frame is a single frame read from the connection, with its payload unmasked.
+type frame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// protocolError is a violation of the protocol by the peer, answered with the given close code.
+type protocolError struct {
+	code   int
+	reason string
+}
+
+func (err *protocolError) Error() string {
+	return "websocket: " + err.reason
+}
+
+// readMessage reads frames until a complete data message is received, handling control frames in between.
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var messageType MessageType
+	var payload []byte
+	var compressed, started bool
+	for {
+		frame, err := c.readFrame(int64(len(payload)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frame.opcode {
+		case opPing:
+			if err := c.writeControl(opPong, frame.payload); err != nil && !errors.Is(err, ErrClosed) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if c.pongHandler != nil {
+				c.pongHandler(frame.payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.handleCloseFrame(frame.payload)
+		case opText, opBinary:
+			if started {
+				return 0, nil, &protocolError{CloseProtocolError, "new message started before the end of a fragmented message"}
+			}
+			started, compressed, messageType = true, frame.rsv1, MessageType(frame.opcode)
+		case opContinuation:
+			if !started {
+				return 0, nil, &protocolError{CloseProtocolError, "continuation frame without a message to continue"}
+			}
+		}
+		payload = append(payload, frame.payload...)
+		if frame.fin {
+			break
+		}
+	}
+
+	if compressed {
+		decompressed, err := decompressMessage(payload, c.options.MaxMessageSize)
+		if errors.Is(err, errMessageTooBig) {
+			return 0, nil, &protocolError{CloseMessageTooBig, "message exceeds the maximum message size"}
+		} else if err != nil {
+			return 0, nil, &protocolError{CloseProtocolError, "invalid compressed message"}
+		}
+		payload = decompressed
+	}
+	if messageType == TextMessage && !utf8.Valid(payload) {
+		return 0, nil, &protocolError{CloseInvalidFramePayloadData, "text message is not valid UTF-8"}
+	}
+	return messageType, payload, nil
+}
+
+// readFrame reads and validates a single frame. received is the size of the message read so far,
+// used to enforce the maximum message size before the payload is allocated.
+func (c *Conn) readFrame(received int64) (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: header[0]&0x80 != 0, rsv1: header[0]&0x40 != 0, opcode: header[0] & 0x0f}
+	isControl := f.opcode >= opClose
+	switch {
+	case header[0]&0x30 != 0:
+		return f, &protocolError{CloseProtocolError, "reserved bits set without a negotiated extension"}
+	case f.rsv1 && (!c.compression || isControl || f.opcode == opContinuation):
+		return f, &protocolError{CloseProtocolError, "unexpected compression bit"}
+	case f.opcode > opBinary && !isControl, f.opcode > opPong:
+		return f, &protocolError{CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode)}
+	case header[1]&0x80 == 0:
+		return f, &protocolError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return f, err
+		}
+		length = int64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return f, err
+		}
+		if extended[0]&0x80 != 0 {
+			return f, &protocolError{CloseProtocolError, "invalid payload length"}
+		}
+		length = int64(binary.BigEndian.Uint64(extended[:]))
+	}
+	if isControl && (!f.fin || length > 125) {
+		return f, &protocolError{CloseProtocolError, "control frames must not be fragmented nor exceed 125 bytes"}
+	}
+	if !isControl && c.options.MaxMessageSize > 0 && received+length > c.options.MaxMessageSize {
+		return f, &protocolError{CloseMessageTooBig, "message exceeds the maximum message size"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return f, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, f.payload); err != nil {
+		return f, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	if c.options.PingInterval > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(2 * c.options.PingInterval))
+	}
+	return f, nil
+}
+
+// handleCloseFrame validates a close frame from the peer, answers it and closes the connection.
+func (c *Conn) handleCloseFrame(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return &protocolError{CloseProtocolError, "invalid close frame payload"}
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !isValidCloseCode(closeErr.Code) {
+			return &protocolError{CloseProtocolError, fmt.Sprintf("invalid close code %d", closeErr.Code)}
+		}
+		if !utf8.Valid(payload[2:]) {
+			return &protocolError{CloseInvalidFramePayloadData, "close reason is not valid UTF-8"}
+		}
+	}
+	// Echo the close code to complete the closing handshake.
+	var reply []byte
+	if closeErr.Code != CloseNoStatusReceived {
+		reply = closePayload(closeErr.Code, "")
+	}
+	c.writeControl(opClose, reply)
+	c.closeConn()
+	return closeErr
+}
+
+// handleReadError closes the connection after a read failure and returns the error exposed to the reader.
+// Protocol violations are reported to the peer with the matching close code.
+func (c *Conn) handleReadError(err error) error {
+	var violation *protocolError
+	if errors.As(err, &violation) {
+		c.writeControl(opClose, closePayload(violation.code, violation.reason))
+		c.closeConn()
+		return &CloseError{Code: violation.code, Text: violation.reason}
+	}
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr
+	}
+	c.closeConn()
+	select {
+	case <-c.closed:
+		return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	default:
+		return err
+	}
+}
+
+// writeData sends a data message in a single frame, or the last fragment of a message, compressing it if negotiated.
+// The caller must hold writeMutex.
+func (c *Conn) writeData(fin bool, opcode byte, data []byte) error {
+	compressed := false
+	if c.compression && len(data) >= c.options.CompressionThreshold {
+		var err error
+		if data, err = compressMessage(data, c.options.CompressionLevel); err != nil {
+			return err
+		}
+		compressed = true
+	}
+	return c.writeFrame(fin, compressed, opcode, data)
+}
+
+// writeControl sends a control frame, waiting for any message being written with NextWriter.
+func (c *Conn) writeControl(opcode byte, payload []byte) error {
+	if len(payload) > 125 {
+		return errors.New("websocket: control frame payload exceeds 125 bytes")
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.writeFrame(true, false, opcode, payload)
+}
+
+// writeFrame writes a single unmasked frame. The caller must hold writeMutex.
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode byte, payload []byte) error {
+	if c.closeSent {
+		return ErrClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 2, 10)
+	if fin {
+		header[0] |= 0x80
+	}
+	if rsv1 {
+		header[0] |= 0x40
+	}
+	header[0] |= opcode
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if c.options.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.options.WriteTimeout))
+	}
+	buffers := net.Buffers{header, payload}
+	if _, err := buffers.WriteTo(c.conn); err != nil {
+		c.closeConn()
+		return err
+	}
+	return nil
+}
+
+// keepAlive sends pings at every PingInterval until the connection is closed.
+func (c *Conn) keepAlive() {
+	ticker := time.NewTicker(c.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.Ping(nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeConn closes the underlying connection once.
+func (c *Conn) closeConn() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// closePayload builds the payload of a close frame, truncating the reason to fit in 125 bytes.
+func closePayload(code int, reason string) []byte {
+	if code == CloseNoStatusReceived || code == CloseAbnormalClosure {
+		return nil
+	}
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return append(payload, reason...)
+}
+
+// isValidCloseCode reports whether a close code may be received in a close frame.
+func isValidCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// testClient is the client side of a connection, writing masked frames and collecting the frames of the server.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	frames chan frame
+}
+
+// newTestConn returns a server connection and its client, connected with net.Pipe.
+func newTestConn(t *testing.T, options Options) (*Conn, *testClient) {
+	t.Helper()
+	serverSide, clientSide := net.Pipe()
+	c := NewConn(serverSide, nil, Handshake{}, options)
+	client := &testClient{t: t, conn: clientSide, frames: make(chan frame, 16)}
+	go client.readFrames()
+	t.Cleanup(func() {
+		c.closeConn()
+		clientSide.Close()
+	})
+	return c, client
+}
+
+// clientFrame encodes a masked client frame.
+func clientFrame(fin bool, opcode byte, payload []byte) []byte {
+	mask := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	header := []byte{opcode, 0x80}
+	if fin {
+		header[0] |= 0x80
+	}
+	switch length := len(payload); {
+	case length < 126:
+		header[1] |= byte(length)
+	case length <= 0xffff:
+		header[1] |= 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] |= 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	header = append(header, mask[:]...)
+	for i, b := range payload {
+		header = append(header, b^mask[i%4])
+	}
+	return header
+}
+
+// send writes the encoded frames in the background, since net.Pipe blocks until the server reads them.
+func (client *testClient) send(frames ...[]byte) {
+	go client.conn.Write(bytes.Join(frames, nil))
+}
+
+// readFrames reads the frames of the server, which must not be masked, until the connection is closed.
+func (client *testClient) readFrames() {
+	defer close(client.frames)
+	reader := bufio.NewReader(client.conn)
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return
+		}
+		if header[1]&0x80 != 0 {
+			client.t.Errorf("server frame is masked")
+			return
+		}
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			var extended [2]byte
+			io.ReadFull(reader, extended[:])
+			length = uint64(binary.BigEndian.Uint16(extended[:]))
+		case 127:
+			var extended [8]byte
+			io.ReadFull(reader, extended[:])
+			length = binary.BigEndian.Uint64(extended[:])
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return
+		}
+		client.frames <- frame{fin: header[0]&0x80 != 0, rsv1: header[0]&0x40 != 0, opcode: header[0] & 0x0f, payload: payload}
+	}
+}
+
+// next returns the next frame of the server.
+func (client *testClient) next() frame {
+	client.t.Helper()
+	select {
+	case f, ok := <-client.frames:
+		if !ok {
+			client.t.Fatal("connection closed before the expected frame")
+		}
+		return f
+	case <-time.After(time.Second):
+		client.t.Fatal("timed out waiting for a frame")
+	}
+	return frame{}
+}
+
+// expectClose reads the next frame, checks that it is a close frame with the given code and returns its reason.
+func (client *testClient) expectClose(code int) string {
+	client.t.Helper()
+	f := client.next()
+	if f.opcode != opClose || len(f.payload) < 2 {
+		client.t.Fatalf("frame is opcode %d with payload %q, want a close frame", f.opcode, f.payload)
+	}
+	if got := int(binary.BigEndian.Uint16(f.payload)); got != code {
+		client.t.Errorf("close code is %d, want %d", got, code)
+	}
+	return string(f.payload[2:])
+}
+
+// expectCloseError checks that err is a *CloseError with the given code.
+func expectCloseError(t *testing.T, err error, code int) {
+	t.Helper()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("error is %v, want a *CloseError", err)
+	}
+	if closeErr.Code != code {
+		t.Errorf("close code is %d, want %d", closeErr.Code, code)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example of RFC 6455, section 1.3.
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey = %q, want s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", got)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	header := func(edit func(textproto.MIMEHeader)) textproto.MIMEHeader {
+		header := textproto.MIMEHeader{}
+		header.Set("Host", "example.com")
+		header.Set("Upgrade", "websocket")
+		header.Set("Connection", "keep-alive, Upgrade")
+		header.Set("Sec-WebSocket-Version", "13")
+		header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if edit != nil {
+			edit(header)
+		}
+		return header
+	}
+
+	handshake, err := Accept("GET", header(nil), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := handshake.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		header textproto.MIMEHeader
+		status int
+	}{
+		{"method", "POST", header(nil), 405},
+		{"upgrade", "GET", header(func(h textproto.MIMEHeader) { h.Del("Upgrade") }), 426},
+		{"version", "GET", header(func(h textproto.MIMEHeader) { h.Set("Sec-WebSocket-Version", "8") }), 426},
+		{"key", "GET", header(func(h textproto.MIMEHeader) { h.Set("Sec-WebSocket-Key", "c2hvcnQ=") }), 400},
+		{"origin", "GET", header(func(h textproto.MIMEHeader) { h.Set("Origin", "https://evil.example") }), 403},
+	}
+	for _, test := range tests {
+		_, err := Accept(test.method, test.header, Options{})
+		var handshakeErr *HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Status != test.status {
+			t.Errorf("%s: error = %v, want a HandshakeError with status %d", test.name, err, test.status)
+		}
+	}
+}
+
+func TestReadMaskedMessage(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	// Masked "Hello" of RFC 6455, section 5.7.
+	client.send([]byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58})
+	messageType, payload, err := c.ReadMessage()
+	if err != nil || messageType != TextMessage || string(payload) != "Hello" {
+		t.Errorf("ReadMessage = %d, %q, %v, want a text message Hello", messageType, payload, err)
+	}
+}
+
+func TestUnmaskedFrameRejected(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	client.send([]byte{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'})
+	_, _, err := c.ReadMessage()
+	expectCloseError(t, err, CloseProtocolError)
+	client.expectClose(CloseProtocolError)
+}
+
+func TestWriteUnmaskedFrames(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	go c.WriteText("Hello")
+	if f := client.next(); !f.fin || f.opcode != opText || string(f.payload) != "Hello" {
+		t.Errorf("frame = %+v, want a final text frame Hello", f)
+	}
+
+	large := bytes.Repeat([]byte{'x'}, 70000)
+	go c.WriteMessage(BinaryMessage, large)
+	if f := client.next(); f.opcode != opBinary || !bytes.Equal(f.payload, large) {
+		t.Errorf("frame is opcode %d with %d bytes, want a binary frame of %d bytes", f.opcode, len(f.payload), len(large))
+	}
+}
+
+func TestFragmentedMessage(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	client.send(clientFrame(false, opText, []byte("Hel")), clientFrame(false, opContinuation, nil), clientFrame(true, opContinuation, []byte("lo")))
+	messageType, payload, err := c.ReadMessage()
+	if err != nil || messageType != TextMessage || string(payload) != "Hello" {
+		t.Errorf("ReadMessage = %d, %q, %v, want a text message Hello", messageType, payload, err)
+	}
+}
+
+func TestWriteFragmentedMessage(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	go func() {
+		writer, _ := c.NextWriter(BinaryMessage)
+		writer.Write([]byte("ab"))
+		writer.Write([]byte("cd"))
+		writer.Close()
+	}()
+	want := []frame{{opcode: opBinary, payload: []byte("ab")}, {opcode: opContinuation, payload: []byte("cd")}, {fin: true, opcode: opContinuation, payload: []byte{}}}
+	for _, expected := range want {
+		if f := client.next(); f.fin != expected.fin || f.opcode != expected.opcode || !bytes.Equal(f.payload, expected.payload) {
+			t.Errorf("frame = %+v, want %+v", f, expected)
+		}
+	}
+}
+
+func TestControlFramesDuringFragmentedMessage(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	pongs := make(chan string, 1)
+	c.SetPongHandler(func(data []byte) { pongs <- string(data) })
+	client.send(
+		clientFrame(false, opText, []byte("Hel")),
+		clientFrame(true, opPing, []byte("ping")),
+		clientFrame(true, opPong, []byte("pong")),
+		clientFrame(true, opContinuation, []byte("lo")),
+	)
+	messageType, payload, err := c.ReadMessage()
+	if err != nil || messageType != TextMessage || string(payload) != "Hello" {
+		t.Errorf("ReadMessage = %d, %q, %v, want a text message Hello", messageType, payload, err)
+	}
+	if f := client.next(); f.opcode != opPong || string(f.payload) != "ping" {
+		t.Errorf("frame is opcode %d with payload %q, want a pong echoing the ping", f.opcode, f.payload)
+	}
+	if got := <-pongs; got != "pong" {
+		t.Errorf("pong handler received %q, want pong", got)
+	}
+}
+
+func TestFramingViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		code   int
+	}{
+		{"continuation without message", [][]byte{clientFrame(true, opContinuation, []byte("lo"))}, CloseProtocolError},
+		{"message within fragmented message", [][]byte{clientFrame(false, opText, []byte("Hel")), clientFrame(true, opText, []byte("lo"))}, CloseProtocolError},
+		{"fragmented control frame", [][]byte{clientFrame(false, opPing, []byte("ping"))}, CloseProtocolError},
+		{"control frame over 125 bytes", [][]byte{clientFrame(true, opPing, bytes.Repeat([]byte{'x'}, 126))}, CloseProtocolError},
+		{"unknown opcode", [][]byte{clientFrame(true, 0x3, nil)}, CloseProtocolError},
+		{"reserved bit", [][]byte{{0xc1, 0x80, 0, 0, 0, 0}}, CloseProtocolError},
+		{"invalid UTF-8", [][]byte{clientFrame(true, opText, []byte{0xff, 0xfe})}, CloseInvalidFramePayloadData},
+		{"message too big", [][]byte{clientFrame(true, opBinary, make([]byte, 11))}, CloseMessageTooBig},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, client := newTestConn(t, Options{MaxMessageSize: 10})
+			client.send(test.frames...)
+			_, _, err := c.ReadMessage()
+			expectCloseError(t, err, test.code)
+			client.expectClose(test.code)
+			if _, _, err := c.ReadMessage(); err == nil {
+				t.Error("ReadMessage succeeded after a protocol violation")
+			}
+		})
+	}
+}
+
+func TestCloseHandshakeFromClient(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	client.send(clientFrame(true, opClose, append(binary.BigEndian.AppendUint16(nil, CloseGoingAway), "bye"...)))
+	_, _, err := c.ReadMessage()
+	expectCloseError(t, err, CloseGoingAway)
+	if closeErr := err.(*CloseError); closeErr.Text != "bye" {
+		t.Errorf("close reason is %q, want bye", closeErr.Text)
+	}
+	client.expectClose(CloseGoingAway)
+	if err := c.WriteText("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteText after close error = %v, want ErrClosed", err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Error("connection not closed after the close handshake")
+	}
+}
+
+func TestCloseHandshakeWithoutStatus(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	client.send(clientFrame(true, opClose, nil))
+	_, _, err := c.ReadMessage()
+	expectCloseError(t, err, CloseNoStatusReceived)
+	if f := client.next(); f.opcode != opClose || len(f.payload) != 0 {
+		t.Errorf("frame is opcode %d with payload %q, want an empty close frame", f.opcode, f.payload)
+	}
+}
+
+func TestInvalidCloseFrames(t *testing.T) {
+	for name, payload := range map[string][]byte{
+		"one byte":           {0x03},
+		"reserved code 1005": binary.BigEndian.AppendUint16(nil, CloseNoStatusReceived),
+		"unassigned code":    binary.BigEndian.AppendUint16(nil, 2000),
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, client := newTestConn(t, Options{})
+			client.send(clientFrame(true, opClose, payload))
+			_, _, err := c.ReadMessage()
+			expectCloseError(t, err, CloseProtocolError)
+			client.expectClose(CloseProtocolError)
+		})
+	}
+}
+
+func TestCloseHandshakeFromServer(t *testing.T) {
+	c, client := newTestConn(t, Options{})
+	go c.Close(CloseNormalClosure, "done")
+	if reason := client.expectClose(CloseNormalClosure); reason != "done" {
+		t.Errorf("close reason is %q, want done", reason)
+	}
+	if _, ok := <-client.frames; ok {
+		t.Error("frame received after the close frame")
+	}
+}
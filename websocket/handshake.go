@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// websocketGUID is the magic value appended to Sec-WebSocket-Key to compute Sec-WebSocket-Accept (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// HandshakeError is returned by Accept when the opening handshake is rejected.
+// Status is the HTTP status code that should be sent back to the client.
+type HandshakeError struct {
+	Status  int
+	Message string
+}
+
+func (err *HandshakeError) Error() string {
+	return "websocket: " + err.Message
+}
+
+// Handshake is the result of an accepted opening handshake.
+type Handshake struct {
+	Header      textproto.MIMEHeader // Headers of the 101 Switching Protocols response.
+	Subprotocol string               // Subprotocol selected from Options.Subprotocols, if any.
+	Compression bool                 // Whether permessage-deflate was negotiated.
+}
+
+// IsUpgradeRequest reports whether the headers ask for an upgrade to the WebSocket protocol.
+func IsUpgradeRequest(header textproto.MIMEHeader) bool {
+	return headerContainsToken(header, "Connection", "upgrade") && headerContainsToken(header, "Upgrade", "websocket")
+}
+
+// Accept validates a client opening handshake and returns the handshake to send back.
+func Accept(method string, header textproto.MIMEHeader, options Options) (Handshake, error) {
+	if method != "GET" {
+		return Handshake{}, &HandshakeError{Status: 405, Message: "the opening handshake must use the GET method"}
+	}
+	if !IsUpgradeRequest(header) {
+		return Handshake{}, &HandshakeError{Status: 426, Message: "the request is not a WebSocket upgrade"}
+	}
+	if header.Get("Sec-WebSocket-Version") != "13" {
+		return Handshake{}, &HandshakeError{Status: 426, Message: "unsupported Sec-WebSocket-Version, only 13 is supported"}
+	}
+	key := strings.TrimSpace(header.Get("Sec-WebSocket-Key"))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return Handshake{}, &HandshakeError{Status: 400, Message: "invalid Sec-WebSocket-Key"}
+	}
+	checkOrigin := options.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(header.Get("Origin"), header.Get("Host")) {
+		return Handshake{}, &HandshakeError{Status: 403, Message: "origin not allowed"}
+	}
+
+	handshake := Handshake{Header: textproto.MIMEHeader{}}
+	handshake.Header.Set("Upgrade", "websocket")
+	handshake.Header.Set("Connection", "Upgrade")
+	handshake.Header.Set("Sec-WebSocket-Accept", AcceptKey(key))
+	if handshake.Subprotocol = selectSubprotocol(header, options.Subprotocols); handshake.Subprotocol != "" {
+		handshake.Header.Set("Sec-WebSocket-Protocol", handshake.Subprotocol)
+	}
+	if options.EnableCompression && acceptsDeflate(header) {
+		handshake.Compression = true
+		// Without context takeover every message is compressed on its own, which keeps memory usage per connection low.
+		handshake.Header.Set("Sec-WebSocket-Extensions", "permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+	return handshake, nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// sameOrigin accepts requests without an Origin header (non-browser clients)
+// and requests whose Origin host matches the Host header.
+func sameOrigin(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, host)
+}
+
+// selectSubprotocol returns the first subprotocol requested by the client that the server supports.
+func selectSubprotocol(header textproto.MIMEHeader, supported []string) string {
+	for _, requested := range headerTokens(header, "Sec-WebSocket-Protocol") {
+		for _, protocol := range supported {
+			if requested == protocol {
+				return protocol
+			}
+		}
+	}
+	return ""
+}
+
+// acceptsDeflate reports whether the client offers permessage-deflate with parameters the server can honor.
+// Offers restricting the server window size are declined, as compress/flate always uses a 32 KiB window.
+func acceptsDeflate(header textproto.MIMEHeader) bool {
+	for _, line := range header.Values("Sec-WebSocket-Extensions") {
+		for _, offer := range strings.Split(line, ",") {
+			parameters := strings.Split(offer, ";")
+			if strings.TrimSpace(parameters[0]) != "permessage-deflate" {
+				continue
+			}
+			acceptable := true
+			for _, parameter := range parameters[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+				if name == "server_max_window_bits" && strings.Trim(value, `"`) != "15" {
+					acceptable = false
+				}
+			}
+			if acceptable {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headerContainsToken reports whether a comma-separated header contains the token, case-insensitively.
+func headerContainsToken(header textproto.MIMEHeader, key, token string) bool {
+	for _, value := range headerTokens(header, key) {
+		if strings.EqualFold(value, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerTokens returns the comma-separated values of a header, trimmed.
+func headerTokens(header textproto.MIMEHeader, key string) []string {
+	var tokens []string
+	for _, line := range header.Values(key) {
+		for _, token := range strings.Split(line, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
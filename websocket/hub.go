@@ -0,0 +1,397 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CloseTryAgainLater is the close code sent to clients disconnected because they could not keep up.
+const CloseTryAgainLater = 1013
+
+// DefaultSendQueueSize is the number of messages queued per client when Hub.SendQueueSize is zero.
+const DefaultSendQueueSize = 64
+
+// closeTimeout is the time allowed to send the close frame to a client before its connection is closed without it.
+const closeTimeout = time.Second
+
+// SlowConsumerPolicy defines what a Hub does when the send queue of a client is full.
+type SlowConsumerPolicy int
+
+// Enumeration of SlowConsumerPolicy.
+const (
+	DisconnectSlowConsumer SlowConsumerPolicy = iota // Close the connection with CloseTryAgainLater.
+	DropMessages                                     // Drop the message for that client only.
+)
+
+// Message is a message fanned out by a Hub, to a room or to every client when Room is empty.
+type Message struct {
+	Room string      `json:"room,omitempty"`
+	Type MessageType `json:"type"`
+	Data []byte      `json:"data"`
+}
+
+// Backend distributes the messages published by hubs. The default LocalBackend only reaches the hubs
+// of the current process; a backend built on a message broker lets hubs of several processes share rooms.
+type Backend interface {
+	// Publish sends the message to every subscriber, including the publishing hub.
+	Publish(ctx context.Context, message Message) error
+	// Subscribe registers a function receiving published messages and returns a function to unregister it.
+	Subscribe(deliver func(message Message)) (unsubscribe func(), err error)
+}
+
+// LocalBackend is an in-process Backend delivering messages synchronously to its subscribers.
+type LocalBackend struct {
+	mutex       sync.RWMutex
+	subscribers map[int]func(message Message)
+	nextID      int
+}
+
+// NewLocalBackend creates a LocalBackend. One instance may be shared by several hubs.
+func NewLocalBackend() *LocalBackend {
+	return &LocalBackend{subscribers: make(map[int]func(message Message))}
+}
+
+// Publish delivers the message to every subscriber.
+func (backend *LocalBackend) Publish(ctx context.Context, message Message) error {
+	// Subscribers are called without holding the lock, so that they can subscribe or unsubscribe.
+	backend.mutex.RLock()
+	subscribers := make([]func(message Message), 0, len(backend.subscribers))
+	for _, deliver := range backend.subscribers {
+		subscribers = append(subscribers, deliver)
+	}
+	backend.mutex.RUnlock()
+	for _, deliver := range subscribers {
+		deliver(message)
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber.
+func (backend *LocalBackend) Subscribe(deliver func(message Message)) (func(), error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	id := backend.nextID
+	backend.nextID++
+	backend.subscribers[id] = deliver
+	return func() {
+		backend.mutex.Lock()
+		defer backend.mutex.Unlock()
+		delete(backend.subscribers, id)
+	}, nil
+}
+
+// ErrHubStopped is returned when using a Hub after Stop.
+var ErrHubStopped = errors.New("websocket: hub stopped")
+
+// Hub groups WebSocket connections in named rooms and fans messages out to them.
+// Each client has a bounded send queue written by its own goroutine, so a slow client never blocks
+// a broadcast; SlowConsumerPolicy decides what happens when its queue is full.
+// A Hub can be listed in core.Module.Providers to be started and stopped with the server.
+type Hub struct {
+	SendQueueSize      int                                   // Capacity of the send queue of each client, DefaultSendQueueSize when zero.
+	SlowConsumerPolicy SlowConsumerPolicy                    // Behavior when the send queue of a client is full.
+	Backend            Backend                               // Fan-out backend, a private LocalBackend when nil.
+	OnConnect          func(client *Client)                  // Called when a client is registered, e.g., to join rooms.
+	OnDisconnect       func(client *Client, err error)       // Called when a client is unregistered, with the error that ended it.
+	OnMessage          func(client *Client, message Message) // Called for each message received by Serve.
+
+	mutex       sync.RWMutex
+	clients     map[*Client]struct{}
+	rooms       map[string]map[*Client]struct{}
+	running     bool
+	stopped     bool
+	unsubscribe func()
+}
+
+// Client is a connection registered in a Hub.
+type Client struct {
+	ID   string // Random identifier of the client.
+	Conn *Conn  // Underlying connection.
+
+	hub   *Hub
+	send  chan Message
+	rooms map[string]struct{} // Guarded by hub.mutex.
+	done  chan struct{}
+	once  sync.Once
+}
+
+// Start subscribes the hub to its backend. It is called automatically on first use when the hub
+// is not registered as a module provider.
+func (hub *Hub) Start(ctx context.Context) error {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return hub.startLocked()
+}
+
+func (hub *Hub) startLocked() error {
+	if hub.stopped {
+		return ErrHubStopped
+	}
+	if hub.running {
+		return nil
+	}
+	if hub.Backend == nil {
+		hub.Backend = NewLocalBackend()
+	}
+	unsubscribe, err := hub.Backend.Subscribe(hub.deliver)
+	if err != nil {
+		return err
+	}
+	hub.clients = make(map[*Client]struct{})
+	hub.rooms = make(map[string]map[*Client]struct{})
+	hub.unsubscribe, hub.running = unsubscribe, true
+	return nil
+}
+
+// Stop unsubscribes the hub from its backend and closes every client with CloseGoingAway.
+func (hub *Hub) Stop(ctx context.Context) error {
+	hub.mutex.Lock()
+	if !hub.running || hub.stopped {
+		hub.stopped = true
+		hub.mutex.Unlock()
+		return nil
+	}
+	hub.stopped, hub.running = true, false
+	unsubscribe := hub.unsubscribe
+	clients := make([]*Client, 0, len(hub.clients))
+	for client := range hub.clients {
+		clients = append(clients, client)
+	}
+	hub.mutex.Unlock()
+
+	unsubscribe()
+	for _, client := range clients {
+		client.close(CloseGoingAway, "server shutting down")
+	}
+	return nil
+}
+
+// Register adds a connection to the hub and starts its writing goroutine.
+func (hub *Hub) Register(conn *Conn) (*Client, error) {
+	queueSize := hub.SendQueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultSendQueueSize
+	}
+	client := &Client{ID: newClientID(), Conn: conn, hub: hub, send: make(chan Message, queueSize), rooms: make(map[string]struct{}), done: make(chan struct{})}
+
+	hub.mutex.Lock()
+	if err := hub.startLocked(); err != nil {
+		hub.mutex.Unlock()
+		return nil, err
+	}
+	hub.clients[client] = struct{}{}
+	hub.mutex.Unlock()
+
+	go client.writeLoop()
+	if hub.OnConnect != nil {
+		hub.OnConnect(client)
+	}
+	return client, nil
+}
+
+// Serve registers the connection, then reads its messages and passes them to OnMessage until the
+// connection is closed. The client is unregistered before Serve returns the error that ended it.
+func (hub *Hub) Serve(conn *Conn) error {
+	client, err := hub.Register(conn)
+	if err != nil {
+		conn.Close(CloseGoingAway, err.Error())
+		return err
+	}
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			hub.Unregister(client, err)
+			return err
+		}
+		if hub.OnMessage != nil {
+			hub.OnMessage(client, Message{Type: messageType, Data: data})
+		}
+	}
+}
+
+// Broadcast sends a message to every client of every hub sharing the backend.
+func (hub *Hub) Broadcast(ctx context.Context, messageType MessageType, data []byte) error {
+	return hub.publish(ctx, Message{Type: messageType, Data: data})
+}
+
+// BroadcastToRoom sends a message to the clients of a room, in every hub sharing the backend.
+func (hub *Hub) BroadcastToRoom(ctx context.Context, room string, messageType MessageType, data []byte) error {
+	if room == "" {
+		return errors.New("websocket: empty room name")
+	}
+	return hub.publish(ctx, Message{Room: room, Type: messageType, Data: data})
+}
+
+// Clients returns the number of clients registered in this hub.
+func (hub *Hub) Clients() int {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	return len(hub.clients)
+}
+
+// Rooms returns the names of the rooms having at least one client in this hub.
+func (hub *Hub) Rooms() []string {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	rooms := make([]string, 0, len(hub.rooms))
+	for room := range hub.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+func (hub *Hub) publish(ctx context.Context, message Message) error {
+	hub.mutex.Lock()
+	err := hub.startLocked()
+	backend := hub.Backend
+	hub.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return backend.Publish(ctx, message)
+}
+
+// deliver queues a message received from the backend for the local clients it targets.
+func (hub *Hub) deliver(message Message) {
+	hub.mutex.RLock()
+	var targets []*Client
+	if message.Room == "" {
+		targets = make([]*Client, 0, len(hub.clients))
+		for client := range hub.clients {
+			targets = append(targets, client)
+		}
+	} else {
+		targets = make([]*Client, 0, len(hub.rooms[message.Room]))
+		for client := range hub.rooms[message.Room] {
+			targets = append(targets, client)
+		}
+	}
+	hub.mutex.RUnlock()
+
+	for _, client := range targets {
+		client.Send(message.Type, message.Data)
+	}
+}
+
+// Unregister removes a client from the hub and its rooms, closes it, then calls OnDisconnect once.
+// Serve calls it automatically; connections registered with Register must be unregistered by the caller.
+func (hub *Hub) Unregister(client *Client, err error) {
+	hub.mutex.Lock()
+	_, registered := hub.clients[client]
+	delete(hub.clients, client)
+	for room := range client.rooms {
+		hub.leaveLocked(client, room)
+	}
+	hub.mutex.Unlock()
+
+	client.close(CloseNormalClosure, "")
+	if registered && hub.OnDisconnect != nil {
+		hub.OnDisconnect(client, err)
+	}
+}
+
+func (hub *Hub) leaveLocked(client *Client, room string) {
+	delete(client.rooms, room)
+	if members, exists := hub.rooms[room]; exists {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(hub.rooms, room)
+		}
+	}
+}
+
+// Join adds the client to a room.
+func (client *Client) Join(room string) {
+	client.hub.mutex.Lock()
+	defer client.hub.mutex.Unlock()
+	if _, registered := client.hub.clients[client]; !registered {
+		return
+	}
+	members, exists := client.hub.rooms[room]
+	if !exists {
+		members = make(map[*Client]struct{})
+		client.hub.rooms[room] = members
+	}
+	members[client] = struct{}{}
+	client.rooms[room] = struct{}{}
+}
+
+// Leave removes the client from a room.
+func (client *Client) Leave(room string) {
+	client.hub.mutex.Lock()
+	defer client.hub.mutex.Unlock()
+	client.hub.leaveLocked(client, room)
+}
+
+// Rooms returns the rooms the client has joined.
+func (client *Client) Rooms() []string {
+	client.hub.mutex.RLock()
+	defer client.hub.mutex.RUnlock()
+	rooms := make([]string, 0, len(client.rooms))
+	for room := range client.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Send queues a message for this client only. It returns false if the message was not queued,
+// because the client is closed or its queue is full. It never blocks.
+func (client *Client) Send(messageType MessageType, data []byte) bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+	}
+	select {
+	case client.send <- Message{Type: messageType, Data: data}:
+		return true
+	default:
+		if client.hub.SlowConsumerPolicy == DisconnectSlowConsumer {
+			// The client is closed before Unregister, which would close it with CloseNormalClosure.
+			client.close(CloseTryAgainLater, "client too slow")
+			go client.hub.Unregister(client, errors.New("websocket: send queue full"))
+		}
+		return false
+	}
+}
+
+// writeLoop writes the queued messages until the client is closed.
+func (client *Client) writeLoop() {
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-client.Conn.Done():
+			return
+		case message := <-client.send:
+			if err := client.Conn.WriteMessage(message.Type, message.Data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// close stops the writing goroutine and closes the connection once, without blocking.
+// The close frame waits for the message being written, which may be stuck on the same slow peer:
+// it is sent in the background, and the connection is closed without it after closeTimeout.
+func (client *Client) close(code int, reason string) {
+	client.once.Do(func() {
+		close(client.done)
+		go func() {
+			timer := time.AfterFunc(closeTimeout, client.Conn.closeConn)
+			defer timer.Stop()
+			client.Conn.Close(code, reason)
+		}()
+	})
+}
+
+// newClientID returns a random identifier for a client.
+func newClientID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
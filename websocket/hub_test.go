@@ -0,0 +1,234 @@
+package websocket
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerTestClient registers a connection in the hub and returns its client, whose frames are read by testClient.
+func registerTestClient(t *testing.T, hub *Hub) (*Client, *testClient) {
+	t.Helper()
+	c, peer := newTestConn(t, Options{})
+	client, err := hub.Register(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, peer
+}
+
+// registerStalledClient registers a connection whose peer does not read until the returned function is called,
+// so that the writes of the hub block once a message is being written.
+func registerStalledClient(t *testing.T, hub *Hub) (*Client, func() *testClient) {
+	t.Helper()
+	serverSide, clientSide := net.Pipe()
+	c := NewConn(serverSide, nil, Handshake{}, Options{})
+	t.Cleanup(func() {
+		c.closeConn()
+		clientSide.Close()
+	})
+	client, err := hub.Register(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, func() *testClient {
+		peer := &testClient{t: t, conn: clientSide, frames: make(chan frame, 16)}
+		go peer.readFrames()
+		return peer
+	}
+}
+
+// fillSendQueue sends messages until the send queue of the client is full, and returns the ones that were queued.
+func fillSendQueue(t *testing.T, client *Client) []string {
+	t.Helper()
+	var queued []string
+	for index := 0; index < 100; index++ {
+		message := "message " + string(rune('a'+index%26))
+		if !client.Send(TextMessage, []byte(message)) {
+			return queued
+		}
+		queued = append(queued, message)
+	}
+	t.Fatal("the send queue never filled up")
+	return nil
+}
+
+// expectText reads the next frame and checks that it is a text frame with the given payload.
+func (client *testClient) expectText(text string) {
+	client.t.Helper()
+	if f := client.next(); f.opcode != opText || string(f.payload) != text {
+		client.t.Errorf("frame is opcode %d with payload %q, want text %q", f.opcode, f.payload, text)
+	}
+}
+
+// waitFor polls condition until it holds, failing the test after a second.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", description)
+}
+
+func TestSlowConsumerDisconnected(t *testing.T) {
+	disconnected := make(chan error, 1)
+	hub := &Hub{SendQueueSize: 2, OnDisconnect: func(client *Client, err error) { disconnected <- err }}
+	client, startReading := registerStalledClient(t, hub)
+
+	queued := fillSendQueue(t, client)
+	if client.Send(TextMessage, []byte("late")) {
+		t.Error("Send queued a message for a disconnected client")
+	}
+	select {
+	case err := <-disconnected:
+		if err == nil || !strings.Contains(err.Error(), "send queue full") {
+			t.Errorf("OnDisconnect error is %v, want send queue full", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the slow client was not unregistered")
+	}
+	if clients := hub.Clients(); clients != 0 {
+		t.Errorf("hub has %d clients, want 0", clients)
+	}
+
+	// A message being written is completed, then the connection is closed with CloseTryAgainLater.
+	peer := startReading()
+	for index := 0; ; index++ {
+		f := peer.next()
+		if f.opcode == opClose {
+			if code, reason := binary.BigEndian.Uint16(f.payload), string(f.payload[2:]); code != CloseTryAgainLater || reason != "client too slow" {
+				t.Errorf("closed with %d %q, want %d client too slow", code, reason, CloseTryAgainLater)
+			}
+			break
+		}
+		if index >= len(queued) || string(f.payload) != queued[index] {
+			t.Fatalf("frame %d is %q, want the queued messages in order then a close frame", index, f.payload)
+		}
+	}
+}
+
+func TestSlowConsumerMessagesDropped(t *testing.T) {
+	hub := &Hub{SendQueueSize: 2, SlowConsumerPolicy: DropMessages}
+	client, startReading := registerStalledClient(t, hub)
+
+	queued := fillSendQueue(t, client)
+	if client.Send(TextMessage, []byte("dropped")) {
+		t.Error("Send queued a message in a full queue")
+	}
+	if clients := hub.Clients(); clients != 1 {
+		t.Fatalf("hub has %d clients, want the slow client to stay registered", clients)
+	}
+
+	peer := startReading()
+	for _, message := range queued {
+		peer.expectText(message)
+	}
+	if !client.Send(TextMessage, []byte("after")) {
+		t.Fatal("Send failed once the queue was drained")
+	}
+	peer.expectText("after")
+}
+
+func TestRooms(t *testing.T) {
+	hub := &Hub{}
+	ctx := context.Background()
+	alice, alicePeer := registerTestClient(t, hub)
+	bob, bobPeer := registerTestClient(t, hub)
+	carol, carolPeer := registerTestClient(t, hub)
+	alice.Join("general")
+	bob.Join("general")
+	bob.Join("random")
+	carol.Join("random")
+
+	rooms := hub.Rooms()
+	sort.Strings(rooms)
+	if strings.Join(rooms, ",") != "general,random" {
+		t.Errorf("hub rooms are %v, want general and random", rooms)
+	}
+	if bobRooms := bob.Rooms(); len(bobRooms) != 2 {
+		t.Errorf("bob joined %v, want two rooms", bobRooms)
+	}
+
+	hub.BroadcastToRoom(ctx, "general", TextMessage, []byte("to general"))
+	alicePeer.expectText("to general")
+	bobPeer.expectText("to general")
+
+	bob.Leave("general")
+	hub.BroadcastToRoom(ctx, "general", TextMessage, []byte("to general again"))
+	alicePeer.expectText("to general again")
+
+	hub.Unregister(carol, nil)
+	carolPeer.expectClose(CloseNormalClosure)
+	rooms = hub.Rooms()
+	sort.Strings(rooms)
+	if strings.Join(rooms, ",") != "general,random" {
+		t.Errorf("hub rooms are %v after carol left, want general and random", rooms)
+	}
+	hub.Unregister(bob, nil)
+	bobPeer.expectClose(CloseNormalClosure)
+	if rooms := hub.Rooms(); len(rooms) != 1 || rooms[0] != "general" {
+		t.Errorf("hub rooms are %v, want the empty room removed", rooms)
+	}
+
+	// The messages of other rooms were not received: the next frame is the broadcast to every client.
+	hub.Broadcast(ctx, TextMessage, []byte("to everyone"))
+	alicePeer.expectText("to everyone")
+	if err := hub.BroadcastToRoom(ctx, "", TextMessage, nil); err == nil {
+		t.Error("BroadcastToRoom accepted an empty room")
+	}
+}
+
+func TestSharedBackend(t *testing.T) {
+	backend := NewLocalBackend()
+	first, second := &Hub{Backend: backend}, &Hub{Backend: backend}
+	firstClient, firstPeer := registerTestClient(t, first)
+	secondClient, secondPeer := registerTestClient(t, second)
+	firstClient.Join("room")
+	secondClient.Join("room")
+
+	first.BroadcastToRoom(context.Background(), "room", TextMessage, []byte("from first"))
+	firstPeer.expectText("from first")
+	secondPeer.expectText("from first")
+
+	// A stopped hub no longer receives the messages published by the others.
+	first.Stop(context.Background())
+	firstPeer.expectClose(CloseGoingAway)
+	second.Broadcast(context.Background(), TextMessage, []byte("from second"))
+	secondPeer.expectText("from second")
+}
+
+func TestStop(t *testing.T) {
+	hub := &Hub{}
+	if err := hub.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_, firstPeer := registerTestClient(t, hub)
+	_, secondPeer := registerTestClient(t, hub)
+
+	if err := hub.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, peer := range []*testClient{firstPeer, secondPeer} {
+		if reason := peer.expectClose(CloseGoingAway); reason != "server shutting down" {
+			t.Errorf("close reason is %q", reason)
+		}
+	}
+
+	c, _ := newTestConn(t, Options{})
+	if _, err := hub.Register(c); !errors.Is(err, ErrHubStopped) {
+		t.Errorf("Register after Stop returned %v, want ErrHubStopped", err)
+	}
+	if err := hub.Broadcast(context.Background(), TextMessage, nil); !errors.Is(err, ErrHubStopped) {
+		t.Errorf("Broadcast after Stop returned %v, want ErrHubStopped", err)
+	}
+	if err := hub.Stop(context.Background()); err != nil {
+		t.Errorf("second Stop returned %v", err)
+	}
+}